@@ -0,0 +1,56 @@
+// Command ipip provides tools for handling ipip data files.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/universal-fraternity/ipip/core"
+)
+
+// runDiff Compare two datasets, exit with 1 when the share of addresses
+// that changed country exceeds the threshold.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	t := fs.String("type", core.Auto, "format name of the data files")
+	limit := fs.Int("limit", 20, "maximum number of ranges listed, -1 for all")
+	maxChange := fs.Float64("max-country-change", 0, "fail when more than this percentage of addresses changed country, 0 to disable")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: ipip diff [flags] <old files> <new files>")
+		_, _ = fmt.Fprintln(fs.Output(), "files are comma separated lists of data files")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	old, err := loadStore(fs.Arg(0), *t)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "load old dataset error,", err)
+		return 2
+	}
+	cur, err := loadStore(fs.Arg(1), *t)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "load new dataset error,", err)
+		return 2
+	}
+
+	report := core.Diff(old, cur)
+	if err = report.Render(os.Stdout, *limit); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *maxChange > 0 {
+		for _, family := range []string{core.IPV4, core.IPV6} {
+			if ratio := report.CountryChangeRatio(family) * 100; ratio > *maxChange {
+				_, _ = fmt.Fprintf(os.Stderr, "%s: %.4f%% of addresses changed country, more than %g%%\n",
+					family, ratio, *maxChange)
+				return 1
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+// Command ipip provides tools for handling ipip data files.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/universal-fraternity/ipip/core"
+)
+
+// runEncrypt Encrypt a data file with an AES-256 key read from a file.
+func runEncrypt(args []string) int {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	keyFile := fs.String("key", "", "file holding the AES-256 key as 64 hex characters")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: ipip encrypt -key <key file> <input> <output>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 || *keyFile == "" {
+		fs.Usage()
+		return 2
+	}
+
+	data, err := os.ReadFile(*keyFile)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "read key error,", err)
+		return 2
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "bad key,", err)
+		return 2
+	}
+	if err = encryptFile(fs.Arg(0), fs.Arg(1), key); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "encrypt error,", err)
+		return 2
+	}
+	return 0
+}
+
+// encryptFile Write the encrypted content of the input file to the output.
+// The output is replaced only once the encryption succeeded.
+func encryptFile(input, output string, key []byte) error {
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.CreateTemp(filepath.Dir(output), filepath.Base(output)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(out.Name()) }()
+	w, err := core.NewEncryptWriter(out, key)
+	if err == nil {
+		_, err = io.Copy(w, in)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), output)
+}
@@ -0,0 +1,59 @@
+// Command ipip provides tools for handling ipip data files.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/universal-fraternity/ipip/core"
+)
+
+// command Define a sub command, run returns the exit code.
+type command struct {
+	usage string
+	run   func(args []string) int
+}
+
+var commands = map[string]command{
+	"diff":    {usage: "compare two datasets", run: runDiff},
+	"patch":   {usage: "make a patch between two datasets", run: runPatch},
+	"encrypt": {usage: "encrypt a data file", run: runEncrypt},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd.run(os.Args[2:]))
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	_, _ = fmt.Fprintln(os.Stderr, "usage: ipip <command> [arguments]")
+	_, _ = fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		_, _ = fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+// loadStore Load a store from a comma separated list of data files.
+func loadStore(paths, t string) (*core.Store, error) {
+	var files []core.FileInfo
+	for _, path := range strings.Split(paths, ",") {
+		files = append(files, core.FileInfo{Path: path, Type: t})
+	}
+	st := core.NewStore()
+	return st, st.LoadData(core.Option{Files: files})
+}
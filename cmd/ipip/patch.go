@@ -0,0 +1,42 @@
+// Command ipip provides tools for handling ipip data files.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/universal-fraternity/ipip/core"
+)
+
+// runPatch Write the patch turning the old dataset into the new one.
+func runPatch(args []string) int {
+	fs := flag.NewFlagSet("patch", flag.ExitOnError)
+	t := fs.String("type", core.Auto, "format name of the data files")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: ipip patch [flags] <old files> <new files>")
+		_, _ = fmt.Fprintln(fs.Output(), "files are comma separated lists of data files, the patch is written to stdout")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	old, err := loadStore(fs.Arg(0), *t)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "load old dataset error,", err)
+		return 2
+	}
+	cur, err := loadStore(fs.Arg(1), *t)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "load new dataset error,", err)
+		return 2
+	}
+	if err = core.MakePatch(os.Stdout, old, cur); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// ErrImmutable Returned when loading data into a store built by a Builder.
+var ErrImmutable = errors.New("store is immutable")
+
+// Builder Construct a store from code instead of data files.
+// IPv6 ranges are indexed by their upper 64 bits, so they must span whole
+// /64 networks to be told apart.
+type Builder struct {
+	ipv4EntityList []*IPV4Entity
+	ipv6EntityList []*IPV6Entity
+	metaList       []*Meta
+	metaTable      map[string]uint32
+	info           Info
+}
+
+// NewBuilder returns a new builder.
+func NewBuilder() *Builder {
+	return &Builder{metaTable: make(map[string]uint32)}
+}
+
+// SetInfo Set the metadata of the built stores, the counts are those of
+// the built ranges.
+func (b *Builder) SetInfo(info Info) {
+	info.IPV4Count, info.IPV6Count = 0, 0
+	b.info = info
+}
+
+// AddPrefix Add the range of a prefix.
+func (b *Builder) AddPrefix(prefix netip.Prefix, meta *Meta) error {
+	if !prefix.IsValid() {
+		return fmt.Errorf("invalid prefix %s", prefix)
+	}
+	prefix = prefix.Masked()
+	return b.AddRange(prefix.Addr(), lastAddr(prefix), meta)
+}
+
+// AddRange Add the range from start to end inclusive. Ranges may be added
+// in any order, overlaps are reported by Build.
+func (b *Builder) AddRange(start, end netip.Addr, meta *Meta) error {
+	start, end = start.Unmap(), end.Unmap()
+	if !start.IsValid() || !end.IsValid() || start.Is4() != end.Is4() {
+		return fmt.Errorf("bad IP range %s-%s", start, end)
+	}
+	if end.Less(start) {
+		return fmt.Errorf("bad IP range %s-%s, start after end", start, end)
+	}
+	fp := meta.Hash()
+	if fp == "" {
+		return fmt.Errorf("empty meta for range %s-%s", start, end)
+	}
+	index, ok := b.metaTable[fp]
+	if !ok {
+		// Later changes of the caller's meta must not reach built stores.
+		index = uint32(len(b.metaList))
+		b.metaList = append(b.metaList, meta.clone())
+		b.metaTable[fp] = index
+	}
+
+	if start.Is4() {
+		s4, e4 := start.As4(), end.As4()
+		b.ipv4EntityList = append(b.ipv4EntityList, &IPV4Entity{
+			startIndex: binary.BigEndian.Uint32(s4[:]),
+			endIndex:   binary.BigEndian.Uint32(e4[:]),
+			metaIndex:  index,
+		})
+	} else {
+		s16, e16 := start.As16(), end.As16()
+		b.ipv6EntityList = append(b.ipv6EntityList, &IPV6Entity{
+			startIndex: binary.BigEndian.Uint64(s16[:]),
+			endIndex:   binary.BigEndian.Uint64(e16[:]),
+			metaIndex:  index,
+		})
+	}
+	return nil
+}
+
+// Build Validate the ranges and return an immutable store holding them.
+// The builder can keep being used afterwards.
+func (b *Builder) Build() (*Store, error) {
+	v4 := append([]*IPV4Entity{}, b.ipv4EntityList...)
+	sort.Slice(v4, func(i, j int) bool { return v4[i].startIndex < v4[j].startIndex })
+	for i := 1; i < len(v4); i++ {
+		if v4[i].startIndex <= v4[i-1].endIndex {
+			return nil, fmt.Errorf("overlapping ranges %s-%s and %s-%s",
+				v4IP(v4[i-1].startIndex), v4IP(v4[i-1].endIndex), v4IP(v4[i].startIndex), v4IP(v4[i].endIndex))
+		}
+	}
+	v6 := append([]*IPV6Entity{}, b.ipv6EntityList...)
+	sort.Slice(v6, func(i, j int) bool { return v6[i].startIndex < v6[j].startIndex })
+	for i := 1; i < len(v6); i++ {
+		if v6[i].startIndex <= v6[i-1].endIndex {
+			return nil, fmt.Errorf("overlapping ranges %s-%s and %s-%s",
+				v6IP(v6[i-1].startIndex, 0), v6IP(v6[i-1].endIndex, ^uint64(0)),
+				v6IP(v6[i].startIndex, 0), v6IP(v6[i].endIndex, ^uint64(0)))
+		}
+	}
+
+	metas := append([]*Meta{}, b.metaList...)
+	return &Store{
+		ipv4EntityList: v4,
+		ipv6EntityList: v6,
+		v4MateList:     metas,
+		v6MateList:     metas,
+		info:           b.info,
+		immutable:      true,
+	}, nil
+}
+
+// lastAddr Return the last address of a masked prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	a16 := prefix.Addr().As16()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += 96
+	}
+	for i := bits; i < 128; i++ {
+		a16[i/8] |= 0x80 >> (i % 8)
+	}
+	last := netip.AddrFrom16(a16)
+	if prefix.Addr().Is4() {
+		return last.Unmap()
+	}
+	return last
+}
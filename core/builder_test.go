@@ -0,0 +1,74 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	cn, jp := &Meta{Country: "中国"}, &Meta{Country: "日本"}
+	b := NewBuilder()
+	for _, err := range []error{
+		b.AddPrefix(netip.MustParsePrefix("10.0.2.0/24"), jp),
+		b.AddRange(netip.MustParseAddr("10.0.0.0"), netip.MustParseAddr("10.0.1.127"), cn),
+		b.AddPrefix(netip.MustParsePrefix("2001:db8::/32"), &Meta{Country: "中国"}),
+		b.AddRange(netip.MustParseAddr("::ffff:10.0.3.0"), netip.MustParseAddr("::ffff:10.0.3.255"), cn),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.IPV4EntityCount() != 3 || st.IPV6EntityCount() != 1 {
+		t.Fatalf("unexpected entity count v4=%d v6=%d", st.IPV4EntityCount(), st.IPV6EntityCount())
+	}
+	for addr, want := range map[string]*Meta{
+		"10.0.1.127": cn, "10.0.1.128": nil, "10.0.2.255": jp, "10.0.3.1": cn, "2001:db8:ffff::1": cn,
+	} {
+		if got := st.Search(net.ParseIP(addr)); got.Hash() != want.Hash() {
+			t.Errorf("Search(%s) = %v, want %v", addr, got, want)
+		}
+	}
+	// the store keeps its own copy of the metas
+	cn.Country = "美国"
+	if got := st.Search(net.ParseIP("10.0.0.1")); got == cn || got.Country != "中国" {
+		t.Errorf("built store changed with the added meta, got %v", got)
+	}
+	cn.Country = "中国"
+	if err = st.LoadData(Option{Files: []FileInfo{{Path: "testdata/v4.txt", Type: IPV4}}}); err != ErrImmutable {
+		t.Errorf("got %v, want ErrImmutable", err)
+	}
+	if err = st.UnmarshalFrom(strings.NewReader(""), IPV4); err != ErrImmutable {
+		t.Errorf("got %v, want ErrImmutable", err)
+	}
+
+	if err = b.AddPrefix(netip.MustParsePrefix("10.0.1.0/24"), jp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Build(); err == nil || !strings.Contains(err.Error(), "overlapping ranges 10.0.0.0-10.0.1.127 and 10.0.1.0-10.0.1.255") {
+		t.Errorf("unexpected overlap error %v", err)
+	}
+}
+
+func TestBuilderInvalid(t *testing.T) {
+	b := NewBuilder()
+	meta := &Meta{Country: "中国"}
+	if err := b.AddRange(netip.MustParseAddr("10.0.0.9"), netip.MustParseAddr("10.0.0.1"), meta); err == nil {
+		t.Error("expected error for reversed range")
+	}
+	if err := b.AddRange(netip.MustParseAddr("10.0.0.0"), netip.MustParseAddr("2001:db8::"), meta); err == nil {
+		t.Error("expected error for mixed families")
+	}
+	if err := b.AddPrefix(netip.Prefix{}, meta); err == nil {
+		t.Error("expected error for invalid prefix")
+	}
+	if err := b.AddPrefix(netip.MustParsePrefix("10.0.0.0/8"), &Meta{}); err == nil {
+		t.Error("expected error for empty meta")
+	}
+}
@@ -0,0 +1,261 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotMagic First bytes of a cached snapshot, followed by its version.
+var snapshotMagic = []byte("IPIPSNAP")
+
+const snapshotVersion = 2
+
+// Stale Report whether the published data was loaded from the
+// last-known-good cache because the data files failed to load. The metas
+// of that data have Meta.Stale set, so that lookup results tell it too.
+func (s *Store) Stale() bool {
+	return s.Report().Stale
+}
+
+// cachePath Return the path of the last-known-good snapshot of the store,
+// named after the data files so that another set of files doesn't start
+// with it. Overlays have their own.
+func (s *Store) cachePath() string {
+	h := sha256.New()
+	for _, fn := range s.opt.Files {
+		_, _ = fmt.Fprintf(h, "%s %s\n", fn.Type, fn.Path)
+	}
+	name := "last-good"
+	if s.source != "" {
+		name += "-" + s.source
+	}
+	return filepath.Join(s.opt.CacheDir, fmt.Sprintf("%s-%x.snap", name, h.Sum(nil)[:8]))
+}
+
+// errUnsignedCache Returned instead of falling back to the last-known-good
+// data of a store with trusted keys, the store can't sign its snapshots.
+var errUnsignedCache = errors.New("no last-known-good data with trusted keys, snapshots are not signed")
+
+// saveCache Write the snapshot as the last-known-good data of the store.
+// With Option.Key or Option.KeyProvider the snapshot is encrypted like the
+// data files, with trusted keys it is not written at all.
+func (s *Store) saveCache(snap *snapshot) error {
+	if len(s.opt.TrustedKeys) > 0 {
+		return errUnsignedCache
+	}
+	path := s.cachePath()
+	key, err := s.cacheKey(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	data, err := snap.MarshalBinary()
+	if err == nil && key != nil {
+		var w io.WriteCloser
+		if w, err = NewEncryptWriter(f, key); err == nil {
+			if _, err = w.Write(data); err == nil {
+				err = w.Close()
+			}
+		}
+	} else if err == nil {
+		_, err = f.Write(data)
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// cacheKey Return the key encrypting the snapshot at path, nil when the
+// data files are not encrypted.
+func (s *Store) cacheKey(path string) ([]byte, error) {
+	if s.opt.KeyProvider != nil {
+		key, err := s.opt.KeyProvider(FileInfo{Path: path})
+		if err != nil {
+			return nil, fmt.Errorf("get key error, %s", err)
+		}
+		return key, nil
+	}
+	return s.opt.Key, nil
+}
+
+// errPublished Returned instead of falling back to the last-known-good
+// data of a store already holding data.
+var errPublished = errors.New("data already published")
+
+// loadCache Publish the last-known-good data of the store as a stale
+// version, cause is the error of the data files. It is only used to start
+// with, a store keeps its data when a later load fails.
+func (s *Store) loadCache(cause error) error {
+	if len(s.opt.TrustedKeys) > 0 {
+		return errUnsignedCache
+	}
+	started := time.Now()
+	path := s.cachePath()
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	r, encrypted, err := s.decrypt(FileInfo{Path: path}, f)
+	if err != nil {
+		return err
+	}
+	if !encrypted && (s.opt.Key != nil || s.opt.KeyProvider != nil) {
+		return errors.New("unencrypted snapshot refused")
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	snap := &snapshot{}
+	if err = snap.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	for _, metas := range [][]*Meta{snap.v4MateList, snap.v6MateList} {
+		for _, meta := range metas {
+			meta.Source, meta.Stale = s.source, true
+			if s.opt.CB != nil {
+				meta.Extends = s.opt.CB(meta)
+			}
+		}
+	}
+	defer s.deliverEvents()
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+	s.mu.RLock()
+	published := len(s.versions) > 0
+	s.mu.RUnlock()
+	if published {
+		return errPublished
+	}
+	s.commit(snap, LoadReport{Stale: true, Err: cause}, started)
+	return nil
+}
+
+// MarshalBinary Implement encoding.BinaryMarshaler. The binary form holds
+// the metadata in JSON, the metas and ranges of each family and ends with
+// its SHA-256.
+func (snap *snapshot) MarshalBinary() ([]byte, error) {
+	b := append([]byte(nil), snapshotMagic...)
+	b = append(b, snapshotVersion)
+	info, err := json.Marshal(snap.info)
+	if err != nil {
+		return nil, err
+	}
+	b = appendString(b, string(info))
+	if b, err = appendMetas(b, snap.v4MateList); err != nil {
+		return nil, err
+	}
+	b = binary.AppendUvarint(b, uint64(len(snap.ipv4EntityList)))
+	for _, e := range snap.ipv4EntityList {
+		b = binary.AppendUvarint(b, uint64(e.startIndex))
+		b = binary.AppendUvarint(b, uint64(e.endIndex-e.startIndex))
+		b = binary.AppendUvarint(b, uint64(e.metaIndex))
+	}
+	if b, err = appendMetas(b, snap.v6MateList); err != nil {
+		return nil, err
+	}
+	b = binary.AppendUvarint(b, uint64(len(snap.ipv6EntityList)))
+	for _, e := range snap.ipv6EntityList {
+		b = binary.AppendUvarint(b, e.startIndex)
+		b = binary.AppendUvarint(b, e.endIndex-e.startIndex)
+		b = binary.AppendUvarint(b, uint64(e.metaIndex))
+	}
+	sum := sha256.Sum256(b)
+	return append(b, sum[:]...), nil
+}
+
+func appendMetas(b []byte, metas []*Meta) ([]byte, error) {
+	b = binary.AppendUvarint(b, uint64(len(metas)))
+	for _, m := range metas {
+		data, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		b = appendString(b, string(data))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary Implement encoding.BinaryUnmarshaler.
+func (snap *snapshot) UnmarshalBinary(data []byte) error {
+	if len(data) < len(snapshotMagic)+1+sha256.Size || !bytes.HasPrefix(data, snapshotMagic) {
+		return errors.New("not a snapshot")
+	}
+	body := data[:len(data)-sha256.Size]
+	if sum := sha256.Sum256(body); !bytes.Equal(sum[:], data[len(body):]) {
+		return errors.New("snapshot checksum mismatch")
+	}
+	if v := body[len(snapshotMagic)]; v != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", v)
+	}
+
+	d := &binaryDecoder{buf: body[len(snapshotMagic)+1:]}
+	v := snapshot{}
+	if err := json.Unmarshal([]byte(d.string()), &v.info); err != nil {
+		return fmt.Errorf("bad snapshot metadata, %s", err)
+	}
+	var err error
+	if v.v4MateList, err = readMetas(d); err != nil {
+		return err
+	}
+	v.ipv4EntityList = make([]*IPV4Entity, d.count())
+	for i := range v.ipv4EntityList {
+		e := &IPV4Entity{startIndex: uint32(d.uvarint())}
+		e.endIndex = e.startIndex + uint32(d.uvarint())
+		e.metaIndex = uint32(d.uvarint())
+		if int(e.metaIndex) >= len(v.v4MateList) {
+			d.fail()
+		}
+		v.ipv4EntityList[i] = e
+	}
+	if v.v6MateList, err = readMetas(d); err != nil {
+		return err
+	}
+	v.ipv6EntityList = make([]*IPV6Entity, d.count())
+	for i := range v.ipv6EntityList {
+		e := &IPV6Entity{startIndex: d.uvarint()}
+		e.endIndex = e.startIndex + d.uvarint()
+		e.metaIndex = uint32(d.uvarint())
+		if int(e.metaIndex) >= len(v.v6MateList) {
+			d.fail()
+		}
+		v.ipv6EntityList[i] = e
+	}
+	if d.err != nil {
+		return fmt.Errorf("bad snapshot, %s", d.err)
+	}
+	if len(d.buf) > 0 {
+		return errors.New("trailing data after snapshot")
+	}
+	*snap = v
+	return nil
+}
+
+func readMetas(d *binaryDecoder) ([]*Meta, error) {
+	metas := make([]*Meta, d.count())
+	for i := range metas {
+		metas[i] = &Meta{}
+		if err := metas[i].UnmarshalBinary([]byte(d.string())); err != nil {
+			return nil, err
+		}
+	}
+	return metas, nil
+}
@@ -0,0 +1,124 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLastKnownGood(t *testing.T) {
+	dir, data := t.TempDir(), t.TempDir()
+	for _, name := range []string{"v4.txt", "v6.txt"} {
+		raw, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(data, name), string(raw))
+	}
+	opt := Option{
+		Files:    []FileInfo{{Path: data + "/v4.txt", Type: IPV4}, {Path: data + "/v6.txt", Type: IPV6}},
+		CacheDir: dir,
+	}
+	st := NewStore()
+	if err := st.LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+	if st.Stale() {
+		t.Error("fresh data flagged as stale")
+	}
+
+	_ = os.Remove(data + "/v4.txt")
+	cached := NewStore()
+	if err := cached.LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+	if !cached.Stale() || cached.Report().Err == nil {
+		t.Errorf("cached data not flagged as stale, report %+v", cached.Report())
+	}
+	if cached.Checksum() != st.Checksum() {
+		t.Error("cached data differs from the loaded data")
+	}
+	if m := cached.Search(net.ParseIP("1.55.29.242")); m == nil || !m.Stale {
+		t.Errorf("cached result not flagged as stale, %v", m)
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.Stale {
+		t.Errorf("fresh result flagged as stale, %v", m)
+	}
+
+	// only to start with, and only for the same data files
+	if err := st.LoadData(opt); err == nil || st.Stale() {
+		t.Errorf("store with data fell back to the cache, %v", err)
+	}
+	other := opt
+	other.Files = []FileInfo{{Path: data + "/v4.txt", Type: IPV4}}
+	if err := NewStore().LoadData(other); err == nil {
+		t.Error("other data files fell back to the cache")
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*.snap"))
+	if len(names) != 1 {
+		t.Fatalf("unexpected snapshots %v", names)
+	}
+	writeFile(t, names[0], "IPIPSNAP\x01corrupted")
+	if err := NewStore().LoadData(opt); err == nil || !strings.Contains(err.Error(), "v4.txt") {
+		t.Errorf("expected data file error with a corrupted cache, got %v", err)
+	}
+}
+
+func TestLastKnownGoodTrust(t *testing.T) {
+	raw, err := os.ReadFile("testdata/v4.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/v4.txt"
+	snaps := func(dir string) []string {
+		names, _ := filepath.Glob(filepath.Join(dir, "*.snap"))
+		return names
+	}
+	writeFile(t, path, string(raw))
+
+	// encrypted like the data files
+	key := make([]byte, 32)
+	opt := Option{Files: []FileInfo{{Path: path, Type: IPV4}}, CacheDir: t.TempDir(), Key: key}
+	if err = NewStore().LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+	names := snaps(opt.CacheDir)
+	if len(names) != 1 {
+		t.Fatalf("unexpected snapshots %v", names)
+	}
+	if data, _ := os.ReadFile(names[0]); !bytes.HasPrefix(data, cryptMagic) {
+		t.Error("snapshot not encrypted")
+	}
+	_ = os.Remove(path)
+	cached := NewStore()
+	if err = cached.LoadData(opt); err != nil || !cached.Stale() {
+		t.Fatalf("encrypted snapshot not loaded, %v", err)
+	}
+
+	// not written nor read with trusted keys
+	writeFile(t, path, string(raw))
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	_ = SignFile(priv, path)
+	opt = Option{Files: []FileInfo{{Path: path, Type: IPV4}}, CacheDir: t.TempDir(), TrustedKeys: []ed25519.PublicKey{pub}}
+	if err = NewStore().LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+	if names = snaps(opt.CacheDir); len(names) != 0 {
+		t.Errorf("unexpected snapshots %v", names)
+	}
+	unsigned := opt
+	unsigned.TrustedKeys = nil
+	if err = NewStore().LoadData(unsigned); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Remove(path)
+	if err = NewStore().LoadData(opt); err == nil {
+		t.Error("expected data file error instead of the unsigned snapshot")
+	}
+}
@@ -0,0 +1,239 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted data files are AES-256-GCM streams cut in chunks, so that they
+// are decrypted without holding the whole file in memory:
+//
+//	header: magic (8 bytes) | chunk size (4 bytes) | nonce prefix (8 bytes)
+//	chunks: sealed chunks of chunk size bytes, the last one may be shorter
+//
+// The nonce of a chunk is the nonce prefix followed by the chunk number,
+// and its additional data is the header followed by 1 for the last chunk
+// and 0 otherwise, so that reordered and truncated streams are refused.
+var cryptMagic = []byte("IPIPENC\x01")
+
+const (
+	cryptHeaderLen    = 20
+	defaultChunkSize  = 64 << 10
+	maxCryptChunkSize = 16 << 20
+)
+
+// KeyProvider Return the AES-256 key of an encrypted data file.
+type KeyProvider func(fn FileInfo) ([]byte, error)
+
+// newAEAD Return the AES-256-GCM cipher of the key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("bad key length %d, want 32 bytes", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cryptStream Define the state shared by the encrypting writer and the
+// decrypting reader.
+type cryptStream struct {
+	aead    cipher.AEAD
+	header  []byte
+	counter uint32
+	nonce   []byte
+	aad     []byte
+}
+
+func newCryptStream(aead cipher.AEAD, header []byte) *cryptStream {
+	return &cryptStream{
+		aead:   aead,
+		header: header,
+		nonce:  make([]byte, aead.NonceSize()),
+		aad:    append(append([]byte(nil), header...), 0),
+	}
+}
+
+// next Prepare the nonce and additional data of the next chunk.
+func (c *cryptStream) next(last bool) error {
+	if c.counter == ^uint32(0) {
+		return errors.New("too many chunks")
+	}
+	copy(c.nonce, c.header[12:20])
+	binary.BigEndian.PutUint32(c.nonce[8:], c.counter)
+	c.counter++
+	c.aad[len(c.aad)-1] = 0
+	if last {
+		c.aad[len(c.aad)-1] = 1
+	}
+	return nil
+}
+
+// encryptWriter Encrypt the data written to it, Close writes the last chunk.
+type encryptWriter struct {
+	*cryptStream
+	w      io.Writer
+	buf    []byte
+	sealed []byte
+	closed bool
+}
+
+// NewEncryptWriter Return a writer encrypting the data written to it into
+// w with the AES-256 key. Close must be called to complete the stream, it
+// does not close w.
+func NewEncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, cryptHeaderLen)
+	copy(header, cryptMagic)
+	binary.BigEndian.PutUint32(header[8:12], defaultChunkSize)
+	if _, err = io.ReadFull(rand.Reader, header[12:20]); err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		cryptStream: newCryptStream(aead, header),
+		w:           w,
+		buf:         make([]byte, 0, defaultChunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is written once it is known not to be the last one
+		if len(e.buf) == cap(e.buf) {
+			if err := e.seal(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close Write the last chunk.
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	if err := e.next(last); err != nil {
+		return err
+	}
+	e.sealed = e.aead.Seal(e.sealed[:0], e.nonce, e.buf, e.aad)
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(e.sealed)
+	return err
+}
+
+// decryptReader Decrypt a stream written by an encryptWriter.
+type decryptReader struct {
+	*cryptStream
+	r     *bufio.Reader
+	buf   []byte
+	plain []byte
+	done  bool
+}
+
+// NewDecryptReader Return a reader decrypting the stream of r with the
+// AES-256 key. Reading fails if the stream was modified or truncated.
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, cryptHeaderLen)
+	if _, err = io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, cryptMagic) {
+		return nil, errors.New("not an encrypted data file")
+	}
+	chunk := binary.BigEndian.Uint32(header[8:12])
+	if chunk == 0 || chunk > maxCryptChunkSize {
+		return nil, fmt.Errorf("bad chunk size %d", chunk)
+	}
+	return &decryptReader{
+		cryptStream: newCryptStream(aead, header),
+		r:           bufio.NewReader(r),
+		buf:         make([]byte, int(chunk)+aead.Overhead()),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// open Decrypt the next chunk.
+func (d *decryptReader) open() error {
+	n, err := io.ReadFull(d.r, d.buf)
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		d.done = true
+	case err != nil:
+		return err
+	default:
+		_, err = d.r.Peek(1)
+		d.done = err == io.EOF
+	}
+	if err = d.next(d.done); err != nil {
+		return err
+	}
+	if d.plain, err = d.aead.Open(d.buf[:0], d.nonce, d.buf[:n], d.aad); err != nil {
+		return errors.New("decrypt error, data file modified, truncated or bad key")
+	}
+	return nil
+}
+
+// decrypt Return the decrypted stream of a data file, or the stream itself
+// when it is not encrypted.
+func (s *Store) decrypt(fn FileInfo, r io.Reader) (io.Reader, bool, error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(len(cryptMagic)); !bytes.Equal(head, cryptMagic) {
+		return br, false, nil
+	}
+	key := s.opt.Key
+	if s.opt.KeyProvider != nil {
+		var err error
+		if key, err = s.opt.KeyProvider(fn); err != nil {
+			return nil, true, fmt.Errorf("get key error, %s", err)
+		}
+	}
+	if key == nil {
+		return nil, true, errors.New("encrypted data file without key")
+	}
+	dr, err := NewDecryptReader(br, key)
+	return dr, true, err
+}
@@ -0,0 +1,88 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"testing"
+)
+
+func encrypt(t *testing.T, key, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	for _, size := range []int{0, 1, defaultChunkSize, defaultChunkSize + 1, 3 * defaultChunkSize} {
+		data := make([]byte, size)
+		_, _ = rand.Read(data)
+		enc := encrypt(t, key, data)
+		r, err := NewDecryptReader(bytes.NewReader(enc), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("size %d: round trip failed, %v", size, err)
+		}
+
+		// truncated at a chunk boundary
+		if size > defaultChunkSize {
+			r, _ = NewDecryptReader(bytes.NewReader(enc[:cryptHeaderLen+defaultChunkSize+16]), key)
+			if _, err = io.ReadAll(r); err == nil {
+				t.Errorf("size %d: expected error for truncated stream", size)
+			}
+		}
+		// modified
+		enc[len(enc)-1] ^= 1
+		r, _ = NewDecryptReader(bytes.NewReader(enc), key)
+		if _, err = io.ReadAll(r); err == nil {
+			t.Errorf("size %d: expected error for modified stream", size)
+		}
+	}
+}
+
+func TestLoadEncrypted(t *testing.T) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	path := t.TempDir() + "/v4.txt.enc"
+	if err := os.WriteFile(path, encrypt(t, key, []byte("start_ip\tend_ip\tcountry\tprovince\n1.55.0.0\t1.55.255.255\t中国\t上海\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewStore()
+	if err := st.LoadData(Option{Files: []FileInfo{{Path: path, Type: Auto}}}); err == nil {
+		t.Error("expected error without key")
+	}
+	if err := st.LoadData(Option{
+		Files:       []FileInfo{{Path: path, Type: Auto}},
+		KeyProvider: func(fn FileInfo) ([]byte, error) { return key, nil },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.Province != "上海" {
+		t.Errorf("unexpected result %v", m)
+	}
+	if fr := st.Report().Files[0]; !fr.Encrypted || fr.Detected != IPV4 {
+		t.Errorf("unexpected report %+v", fr)
+	}
+	key[0] ^= 1
+	if err := st.Update(); err == nil {
+		t.Error("expected error with bad key")
+	}
+}
@@ -0,0 +1,253 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Record Define a decoded data record, an address range and its metadata.
+// Decoders report a rejected row as a record with Err set, and fields they
+// zeroed because of invalid values in Invalid.
+type Record struct {
+	Start   net.IP        // First address of the range
+	End     net.IP        // Last address of the range
+	Meta    *Meta         // Location information of the range
+	Line    int           // Line number of the row in the source, if known
+	Err     error         // Reason the row was rejected
+	Invalid []*FieldError // Fields zeroed because of invalid values
+}
+
+// RecordFunc Callback invoked for every decoded record.
+// Returning an error stops decoding.
+type RecordFunc func(rec *Record) error
+
+// Decoder Define a data file decoder.
+// Decode reads records from r and passes each of them to fn,
+// it returns nil once the reader is exhausted.
+type Decoder interface {
+	Decode(r io.Reader, fn RecordFunc) error
+}
+
+// DecoderFunc Adapter to allow the use of ordinary functions as decoders.
+type DecoderFunc func(r io.Reader, fn RecordFunc) error
+
+// Decode calls f(r, fn).
+func (f DecoderFunc) Decode(r io.Reader, fn RecordFunc) error {
+	return f(r, fn)
+}
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = make(map[string]Decoder)
+)
+
+func init() {
+	RegisterDecoder(IPV4, &textDecoder{family: IPV4})
+	RegisterDecoder(IPV6, &textDecoder{family: IPV6})
+}
+
+// RegisterDecoder Register a decoder for the format name, so that it can be
+// referenced by FileInfo.Type. Registering an existing name replaces it.
+func RegisterDecoder(name string, d Decoder) {
+	if name == Unknown || d == nil {
+		panic("core: RegisterDecoder with empty name or nil decoder")
+	}
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[name] = d
+}
+
+// LookupDecoder Return the decoder registered for the format name.
+func LookupDecoder(name string) (Decoder, bool) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	d, ok := decoders[name]
+	return d, ok
+}
+
+// Decoders Return the sorted names of all registered formats.
+func Decoders() []string {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	names := make([]string, 0, len(decoders))
+	for name := range decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Configurable is implemented by decoders that depend on the store option,
+// the store decodes with the decoder returned by Configure.
+type Configurable interface {
+	Configure(opt Option) Decoder
+}
+
+// textDecoder Decoder of the tab separated ipip text format of one family.
+type textDecoder struct {
+	family string
+	schema *Schema
+	mode   ParseMode
+}
+
+// Configure Return a decoder using the schema and parse mode of the option.
+func (d *textDecoder) Configure(opt Option) Decoder {
+	return &textDecoder{family: d.family, schema: opt.Schema, mode: opt.ParseMode}
+}
+
+// Decode Decode text rows into records, escaped backslashes, tabs and line
+// breaks of the values are unescaped like Meta.UnmarshalText.
+func (d *textDecoder) Decode(r io.Reader, fn RecordFunc) error {
+	columns, required, err := d.schema.columns(d.family)
+	if err != nil {
+		return err
+	}
+	// Fields beyond the default layout are attribute columns, beyond a
+	// declared layout only when the schema keeps unknown columns.
+	extraAttrs := d.schema == nil || len(d.schema.Columns) == 0 || d.schema.Attrs
+	first := true
+	strs := make(interner)
+	return readLines(r, func(n int, line string) error {
+		fields := splitRow(line)
+		if first {
+			first = false
+			if d.schema.isHeaderRow(fields) {
+				if columns, err = d.schema.Resolve(fields); err != nil {
+					return fmt.Errorf("bad header line, %s", err)
+				}
+				required = len(columns)
+				extraAttrs = d.schema != nil && d.schema.Attrs
+				return nil
+			}
+		}
+
+		for i, field := range fields {
+			if strings.IndexByte(field, '\\') >= 0 {
+				fields[i] = textUnescaper.Replace(field)
+			}
+		}
+		rowMeta := &RowMeta{}
+		rec := &Record{Line: n}
+		fieldErrs := rowMeta.unmarshalColumns(fields, columns)
+		if len(fields) < required || (d.mode == Strict && !extraAttrs && len(fields) > len(columns)) {
+			fieldErrs = append(fieldErrs, &FieldError{
+				Err: fmt.Errorf("expected %d columns, got %d", len(columns), len(fields)),
+			})
+		}
+		switch {
+		case rowMeta.Mode() != d.family:
+			// Bad IP metadata, the range can't be zeroed
+			rec.Err = fmt.Errorf("bad IP metadata, start_ip=%s", rowMeta.StartIP)
+			if len(fieldErrs) > 0 {
+				rec.Err = joinFieldErrors(fieldErrs)
+			}
+		case len(fieldErrs) > 0 && d.mode == Strict:
+			rec.Err = joinFieldErrors(fieldErrs)
+		default:
+			rowMeta.Attrs = strs.attrs(rowMeta.Attrs)
+			rec.Start = rowMeta.StartIPObj()
+			rec.End = rowMeta.EndIpObj()
+			rec.Meta = rowMeta.Meta()
+			rec.Invalid = fieldErrs
+		}
+		return fn(rec)
+	})
+}
+
+// Detect Report whether the first data row holds a range of the family,
+// either as a start/end pair or as a CIDR.
+func (d *textDecoder) Detect(head []byte) bool {
+	lines := dataLines(head)
+	if len(lines) > 0 && isHeader(splitRow(lines[0])) {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return false
+	}
+	fields := splitRow(lines[0])
+	var start net.IP
+	if ip, _, err := net.ParseCIDR(fields[0]); err == nil {
+		start = ip
+	} else if len(fields) > 1 && net.ParseIP(fields[1]) != nil {
+		start = net.ParseIP(fields[0])
+	}
+	switch {
+	case start == nil:
+		return false
+	case start.To4() != nil:
+		return d.family == IPV4
+	default:
+		return d.family == IPV6
+	}
+}
+
+// MatchColumns Report whether rows of n columns fit the layout of files
+// without header line.
+func (d *textDecoder) MatchColumns(n int) bool {
+	columns, required, err := d.schema.columns(d.family)
+	return err == nil && n >= required && n <= len(columns)
+}
+
+// joinFieldErrors Return the errors of a row as a single error.
+func joinFieldErrors(fieldErrs []*FieldError) error {
+	errs := make([]error, len(fieldErrs))
+	for i, fe := range fieldErrs {
+		errs[i] = fe
+	}
+	return errors.Join(errs...)
+}
+
+// readLines Pass every data line of a text file and its line number to fn,
+// without line ending. A leading UTF-8 BOM, CRLF line endings, blank lines, lines starting with
+// '#' and a final line without line ending are all handled.
+func readLines(r io.Reader, fn func(n int, line string) error) error {
+	iReader := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := iReader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 1 {
+			line = strings.TrimPrefix(line, utf8BOM)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "#") {
+			if e := fn(n, line); e != nil {
+				return e
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// interner Share the memory of identical strings between records.
+type interner map[string]string
+
+func (in interner) intern(s string) string {
+	if v, ok := in[s]; ok {
+		return v
+	}
+	in[s] = s
+	return s
+}
+
+// attrs Return the attributes with interned keys and values.
+func (in interner) attrs(a Attrs) Attrs {
+	if len(a) == 0 {
+		return nil
+	}
+	shared := make(Attrs, len(a))
+	for k, v := range a {
+		shared[in.intern(k)] = in.intern(v)
+	}
+	return shared
+}
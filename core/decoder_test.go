@@ -0,0 +1,260 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSchemaHeader(t *testing.T) {
+	data := "end_ip\tstart_ip\tasn\tcountry\tcity\n" +
+		"10.0.0.255\t10.0.0.0\t4538,24370\t中国\t大连\n"
+	st := NewStore()
+	if err := st.UnmarshalFrom(strings.NewReader(data), IPV4); err != nil {
+		t.Fatal(err)
+	}
+	m := st.Search(net.ParseIP("10.0.0.1"))
+	if m == nil || m.Country != "中国" || m.City != "大连" || len(m.Asn) != 2 || m.Asn[1] != 24370 {
+		t.Fatalf("unexpected meta %v", m)
+	}
+
+	if err := NewStore().UnmarshalFrom(strings.NewReader("start_ip\tend_ip\tdc_tag\n"), IPV4); err == nil {
+		t.Error("expected unknown column error")
+	}
+	if err := NewStore().UnmarshalFrom(strings.NewReader("start_ip\tend_ip\tcity\tCity\n"), IPV4); err == nil {
+		t.Error("expected duplicate column error")
+	}
+	if err := NewStore().UnmarshalFrom(strings.NewReader("start_ip\tcountry\n"), IPV4); err == nil {
+		t.Error("expected missing range column error")
+	}
+}
+
+func TestSchemaOption(t *testing.T) {
+	st := NewStore()
+	st.opt.Schema = &Schema{
+		Columns: []string{"network", "iso", "isp"},
+		Fields:  map[string]string{"network": ColCIDR, "iso": ColCountryCode, "isp": ColIspDomain},
+	}
+	if err := st.UnmarshalFrom(strings.NewReader("2001:db8::/32\tCN\texample.com\n"), IPV6); err != nil {
+		t.Fatal(err)
+	}
+	m := st.Search(net.ParseIP("2001:db8::1"))
+	if m == nil || m.CountryCode != "CN" || m.IspDomain != "example.com" {
+		t.Fatalf("unexpected meta %v", m)
+	}
+
+	// vendor names are also translated in header lines
+	if err := st.UnmarshalFrom(strings.NewReader("iso\tnetwork\nJP\t2001:db9::/32\n"), IPV6); err != nil {
+		t.Fatal(err)
+	}
+	if m = st.Search(net.ParseIP("2001:db9::1")); m == nil || m.CountryCode != "JP" {
+		t.Fatalf("unexpected meta %v", m)
+	}
+}
+
+func TestSchemaFirstRow(t *testing.T) {
+	// with Columns, a first row that is not a layout is data
+	st := NewStore()
+	st.opt.Schema = &Schema{Columns: []string{ColCountry, ColStartIP, ColEndIP}}
+	if err := st.UnmarshalFrom(strings.NewReader("CN\t1.0.0.0\t1.0.0.255\nJP\t1.0.1.0\t1.0.1.255\n"), IPV4); err != nil {
+		t.Fatal(err)
+	}
+	if m := st.Search(net.ParseIP("1.0.0.1")); m == nil || m.Country != "CN" || st.IPV4EntityCount() != 2 {
+		t.Fatalf("unexpected meta %v", m)
+	}
+
+	// a malformed first row is rejected alone
+	data := "bad row\t1.0.0.255\t中国\n1.0.1.0\t1.0.1.255\t中国" + strings.Repeat("\t*", 13) + "\n"
+	snap := &snapshot{}
+	fr, err := NewStore().unmarshalFrom(strings.NewReader(data), IPV4, snap)
+	if err != nil || fr.Rejected != 1 || fr.IPV4Count != 1 || fr.Errors[0].Line != 1 {
+		t.Errorf("unexpected report %+v, %v", fr, err)
+	}
+}
+
+func TestAttrs(t *testing.T) {
+	data := "start_ip\tend_ip\tcountry\tdc_tag\trisk_tier\n" +
+		"10.0.0.0\t10.0.0.255\t中国\tsh-01\t2\textra\n" +
+		"10.0.1.0\t10.0.1.255\t中国\tsh-02\t*\n" +
+		"10.0.2.0\t10.0.2.255\t中国\tsh-01\t2\textra\n"
+	st := NewStore()
+	st.opt.Schema = &Schema{Attrs: true}
+	if err := st.UnmarshalFrom(strings.NewReader(data), IPV4); err != nil {
+		t.Fatal(err)
+	}
+	m := st.Search(net.ParseIP("10.0.0.1"))
+	if m.Attr("dc_tag") != "sh-01" || m.Attr("risk_tier") != "2" || m.Attr("col5") != "extra" {
+		t.Fatalf("unexpected attrs %v", m.Attrs)
+	}
+	if m2 := st.Search(net.ParseIP("10.0.1.1")); len(m2.Attrs) != 1 || m2.Attr("dc_tag") != "sh-02" {
+		t.Fatalf("unexpected attrs %v", m2.Attrs)
+	}
+	// attributes take part in deduplication
+	if m3 := st.Search(net.ParseIP("10.0.2.1")); m3 != m {
+		t.Error("expected identical metas to be shared")
+	}
+	if !strings.Contains(m.String(), "attrs:col5=extra,dc_tag=sh-01,risk_tier=2") {
+		t.Errorf("attributes missing from %s", m)
+	}
+	// a value holding separators must not pass for two attributes
+	one := &Meta{Attrs: Attrs{"a": "1,b=2"}}
+	two := &Meta{Attrs: Attrs{"a": "1", "b": "2"}}
+	if one.hash() == two.hash() {
+		t.Error("expected different attributes to hash differently")
+	}
+}
+
+func TestTypeAndComment(t *testing.T) {
+	v4 := strings.Join(append(append([]string{}, V4Columns...), ColType, ColComment), "\t") + "\n" +
+		"10.0.0.0\t10.0.0.255\t中国\t上海\t上海\t*\t*\texample.com\t310000\t31.2\t121.4\tAsia/Shanghai\tCN\t4812\t*\t*\tIDC\tcore dc\n" +
+		"10.0.1.0\t10.0.1.255\t中国\t上海\t上海\t*\t*\texample.com\t310000\t31.2\t121.4\tAsia/Shanghai\tCN\t4812\t*\t*\tIDC\t*\n" +
+		"10.0.2.0\t10.0.2.255\t中国\t上海\t上海\t*\t*\texample.com\t310000\t31.2\t121.4\tAsia/Shanghai\tCN\t4812\t*\t*\t*\t*\n"
+	st := NewStore()
+	if err := st.UnmarshalFrom(strings.NewReader(v4), IPV4); err != nil {
+		t.Fatal(err)
+	}
+	m := st.Search(net.ParseIP("10.0.0.1"))
+	if m.Type == nil || *m.Type != "IDC" || m.Comment == nil || *m.Comment != "core dc" {
+		t.Fatalf("unexpected type/comment %v", m)
+	}
+	m2 := st.Search(net.ParseIP("10.0.1.1"))
+	if m2 == m || m2.Type == nil || m2.Comment != nil {
+		t.Fatalf("unexpected type/comment %v", m2)
+	}
+	m3 := st.Search(net.ParseIP("10.0.2.1"))
+	if m3 == m2 || m3.Type != nil || m3.Comment != nil {
+		t.Fatalf("unexpected type/comment %v", m3)
+	}
+	if m.Hash() == m2.Hash() || m2.Hash() == m3.Hash() {
+		t.Error("type and comment must take part in the hash")
+	}
+	if !strings.Contains(m.String(), "type:IDC comment:core dc") {
+		t.Errorf("type and comment missing from %s", m)
+	}
+	if line, _ := m.MarshalString(); !strings.HasSuffix(line, "\tIDC\tcore dc") {
+		t.Errorf("type and comment missing from %q", line)
+	}
+
+	v6 := "cidr\tcountry\tnetwork_type\n2001:db8::/32\t中国\tanycast\n"
+	if err := st.UnmarshalFrom(strings.NewReader(v6), IPV6); err != nil {
+		t.Fatal(err)
+	}
+	if m = st.Search(net.ParseIP("2001:db8::1")); m.Type == nil || *m.Type != "anycast" {
+		t.Fatalf("unexpected type %v", m)
+	}
+
+	// without header line trailing columns are attributes, as before
+	v4 = "10.0.3.0\t10.0.3.255\t中国\t上海\t上海\t*\t*\texample.com\t310000\t31.2\t121.4\tAsia/Shanghai\tCN\t4812\t*\t*\tIDC\n"
+	if err := st.UnmarshalFrom(strings.NewReader(v4), IPV4); err != nil {
+		t.Fatal(err)
+	}
+	if m = st.Search(net.ParseIP("10.0.3.1")); m.Type != nil || m.Attr("col16") != "IDC" {
+		t.Fatalf("unexpected trailing column %v", m)
+	}
+	// and the network type with the ipip.net schema
+	typed := NewStore()
+	typed.opt.Schema = IPIPSchema()
+	if err := typed.UnmarshalFrom(strings.NewReader(v4), IPV4); err != nil {
+		t.Fatal(err)
+	}
+	if m = typed.Search(net.ParseIP("10.0.3.1")); m.Type == nil || *m.Type != "IDC" || len(m.Attrs) != 0 {
+		t.Fatalf("unexpected network type %v", m)
+	}
+	v6 = "2001:db8::/32\t中国" + strings.Repeat("\t*", 13) + "\tanycast\n"
+	if err := typed.UnmarshalFrom(strings.NewReader(v6), IPV6); err != nil {
+		t.Fatal(err)
+	}
+	if m = typed.Search(net.ParseIP("2001:db8::1")); m.Type == nil || *m.Type != "anycast" {
+		t.Fatalf("unexpected network type %v", m)
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	row := func(start, end, line string) string {
+		return start + "\t" + end + "\t中国\t*\t*\t*\t*\t*\t*\t*\t*\t*\tCN\t4538\t*\t" + line
+	}
+	for name, data := range map[string]string{
+		"crlf":         row("10.0.0.0", "10.0.0.255", "电信") + "\r\n" + row("10.0.1.0", "10.0.1.255", "联通") + "\r\n",
+		"bom":          "\xef\xbb\xbf" + row("10.0.0.0", "10.0.0.255", "电信") + "\n" + row("10.0.1.0", "10.0.1.255", "联通") + "\n",
+		"comments":     "# vendor export\n" + row("10.0.0.0", "10.0.0.255", "电信") + "\n#\n" + row("10.0.1.0", "10.0.1.255", "联通") + "\n",
+		"blank":        "\n" + row("10.0.0.0", "10.0.0.255", "电信") + "\n\n  \r\n" + row("10.0.1.0", "10.0.1.255", "联通") + "\n\n",
+		"unterminated": row("10.0.0.0", "10.0.0.255", "电信") + "\n" + row("10.0.1.0", "10.0.1.255", "联通"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			st := NewStore()
+			if err := st.UnmarshalFrom(strings.NewReader(data), Auto); err != nil {
+				t.Fatal(err)
+			}
+			if st.IPV4EntityCount() != 2 {
+				t.Fatalf("got %d entities, want 2", st.IPV4EntityCount())
+			}
+			if m := st.Search(net.ParseIP("10.0.0.1")); m == nil || m.Line != "电信" {
+				t.Errorf("unexpected meta %v", m)
+			}
+			if m := st.Search(net.ParseIP("10.0.1.1")); m == nil || m.Line != "联通" {
+				t.Errorf("unexpected meta %v", m)
+			}
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	data := "start_ip\tend_ip\tcountry\tchina_admin_code\tlatitude\tlongitude\tasn\n" +
+		"10.0.0.0\t10.0.0.255\t中国\t310000\t31.2\t121.4\t4812\n" +
+		"10.0.1.0\t10.0.1.255\t中国\tabc\t31.2\t121.4\t4812\n" +
+		"10.0.2.0\t10.0.2.255\t中国\t310000\t95\t121.4\t4812\n" +
+		"10.0.3.0\t10.0.3.255\t中国\t310000\t31.2\t121.4\tAS4812\n" +
+		"10.0.4.0\t10.0.4.255\t中国\t310000\t31.2\n" +
+		"10.0.5.0\tnot-an-ip\t中国\t310000\t31.2\t121.4\t4812\n" +
+		"10.0.6.255\t10.0.6.0\t中国\t310000\t31.2\t121.4\t4812\n"
+
+	st, snap := NewStore(), &snapshot{}
+	st.opt.ParseMode = Lenient
+	fr, err := st.unmarshalFrom(strings.NewReader(data), IPV4, snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.publish(snap)
+	if fr.Rows != 7 || fr.Rejected != 2 || fr.Flagged != 4 || fr.IPV4Count != 5 || len(fr.Errors) != 6 {
+		t.Fatalf("unexpected lenient report %+v", fr)
+	}
+	if fr.Errors[0].Line != 3 || !strings.Contains(fr.Errors[0].Error(), "china_admin_code") {
+		t.Errorf("unexpected error %s", fr.Errors[0])
+	}
+	if m := st.Search(net.ParseIP("10.0.1.1")); m == nil || m.ChinaAdminCode != 0 || m.Latitude != 31.2 {
+		t.Errorf("invalid field must be zeroed, got %v", m)
+	}
+	if m := st.Search(net.ParseIP("10.0.2.1")); m == nil || m.Latitude != 0 || m.Longitude != 121.4 {
+		t.Errorf("out of range latitude must be zeroed, got %v", m)
+	}
+	if m := st.Search(net.ParseIP("10.0.3.1")); m == nil || len(m.Asn) != 0 {
+		t.Errorf("invalid asn must be zeroed, got %v", m)
+	}
+
+	st = NewStore()
+	st.opt.ParseMode = Strict
+	if fr, err = st.unmarshalFrom(strings.NewReader(data), IPV4, &snapshot{}); err != nil {
+		t.Fatal(err)
+	}
+	if fr.Rows != 7 || fr.Rejected != 6 || fr.Flagged != 0 || fr.IPV4Count != 1 {
+		t.Fatalf("unexpected strict report %+v", fr)
+	}
+	if m := st.Search(net.ParseIP("10.0.1.1")); m != nil {
+		t.Errorf("row with invalid field must be rejected, got %v", m)
+	}
+
+	// strict mode also rejects rows with extra columns
+	extra := "10.0.0.0\t10.0.0.255\t中国\t310000\t31.2\t121.4\t4812\textra\n"
+	if fr, _ = st.unmarshalFrom(strings.NewReader("start_ip\tend_ip\tcountry\tchina_admin_code\tlatitude\tlongitude\tasn\n"+extra), IPV4, &snapshot{}); fr.Rejected != 1 {
+		t.Errorf("unexpected strict report %+v", fr)
+	}
+
+	// strict is the default, trailing attribute columns of the default
+	// layout are accepted while a bad asn is not
+	row := "10.0.7.0\t10.0.7.255\t中国\t上海\t上海\t*\t*\texample.com\t310000\t31.2\t121.4\tAsia/Shanghai\tCN\t%s\t*\t*\tdc\n"
+	if fr, _ = NewStore().unmarshalFrom(strings.NewReader(fmt.Sprintf(row, "4812")+fmt.Sprintf(row, "AS4812")), IPV4, &snapshot{}); fr.Rejected != 1 || fr.IPV4Count != 1 {
+		t.Errorf("unexpected default report %+v", fr)
+	}
+}
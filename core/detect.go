@@ -0,0 +1,179 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Auto Format name that lets the store detect the format of a data file.
+const Auto = "auto"
+
+// sniffLen Number of bytes inspected to detect the format of a data file.
+const sniffLen = 4096
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+// unsupportedMagics Magic bytes of compressed and archived files the store
+// can't read, so that they are reported by name instead of as bad text.
+var unsupportedMagics = []struct {
+	name  string
+	magic []byte
+}{
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{"zip", []byte{'P', 'K', 0x03, 0x04}},
+	{"7z", []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+}
+
+// utf8BOM Byte order mark some editors put at the start of text files.
+const utf8BOM = "\xef\xbb\xbf"
+
+// Detector is implemented by decoders that recognise their own format from
+// the head of a data file, such decoders take part in Auto detection.
+type Detector interface {
+	Detect(head []byte) bool
+}
+
+// BinaryFormat is implemented by decoders of binary formats, which Auto
+// detection recognises by the magic bytes their files start with.
+type BinaryFormat interface {
+	Magic() []byte
+}
+
+// ColumnMatcher is implemented by decoders of text formats that expect a
+// certain number of columns. When several decoders detect a file, Auto
+// detection prefers those matching the columns of its first data row.
+type ColumnMatcher interface {
+	MatchColumns(n int) bool
+}
+
+// DetectFormat Return the name of the registered format matching the head
+// of a data file. Binary formats are recognised by their magic bytes first,
+// ties between text formats are broken by the number of columns.
+func DetectFormat(head []byte) (string, error) {
+	var matches []string
+	for _, name := range Decoders() {
+		dec, _ := LookupDecoder(name)
+		if b, ok := dec.(BinaryFormat); ok && len(b.Magic()) > 0 && bytes.HasPrefix(head, b.Magic()) {
+			return name, nil
+		}
+		if d, ok := dec.(Detector); ok && d.Detect(head) {
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) == 0 {
+		return Unknown, errors.New("unable to detect data format")
+	}
+	if len(matches) > 1 {
+		n := dataColumns(head)
+		for _, name := range matches {
+			dec, _ := LookupDecoder(name)
+			if m, ok := dec.(ColumnMatcher); ok && m.MatchColumns(n) {
+				return name, nil
+			}
+		}
+	}
+	return matches[0], nil
+}
+
+// sniff Peek at the head of the reader, transparently decompressing gzip
+// and bzip2 data, and resolve the format name t when it is Auto. Malformed
+// metadata lines fail the file in Strict mode and are reported otherwise.
+// The returned reader must be used in place of r.
+func sniff(r io.Reader, t string, mode ParseMode, report *FileReport) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, _ := br.Peek(sniffLen)
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, t, fmt.Errorf("open gzip stream error, %s", err)
+		}
+		report.Compression = "gzip"
+		br = bufio.NewReaderSize(zr, sniffLen)
+		head, _ = br.Peek(sniffLen)
+	case bytes.HasPrefix(head, bzip2Magic):
+		report.Compression = "bzip2"
+		br = bufio.NewReaderSize(bzip2.NewReader(br), sniffLen)
+		head, _ = br.Peek(sniffLen)
+	}
+	for _, u := range unsupportedMagics {
+		if bytes.HasPrefix(head, u.magic) {
+			return nil, t, fmt.Errorf("%s data is not supported", u.name)
+		}
+	}
+	info, errs := parseInfo(head)
+	if len(errs) > 0 && mode == Strict {
+		return nil, t, errs[0]
+	}
+	for _, e := range errs {
+		report.addError(e.Line, e.Err)
+	}
+	report.Info = info
+	if line := firstDataLine(head); line != "" {
+		report.Columns = strings.Count(line, "\t") + 1
+	}
+
+	if t == Auto {
+		var err error
+		if t, err = DetectFormat(head); err != nil {
+			return nil, t, err
+		}
+	} else if dec, ok := LookupDecoder(t); ok {
+		// Refuse data that obviously belongs to another format instead of
+		// rejecting it row by row.
+		if d, ok := dec.(Detector); ok && !d.Detect(head) {
+			if detected, err := DetectFormat(head); err == nil {
+				return nil, t, fmt.Errorf("data type mismatch, configured %s but detected %s", t, detected)
+			}
+		}
+	}
+	report.Detected = t
+	return br, t, nil
+}
+
+// firstDataLine Return the first line of head that is neither blank nor
+// a comment.
+func firstDataLine(head []byte) string {
+	if lines := dataLines(head); len(lines) > 0 {
+		return lines[0]
+	}
+	return ""
+}
+
+// dataColumns Return the number of columns of the first data row of head,
+// skipping a header line.
+func dataColumns(head []byte) int {
+	lines := dataLines(head)
+	if len(lines) > 0 && isHeader(splitRow(lines[0])) {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return 0
+	}
+	return len(splitRow(lines[0]))
+}
+
+// dataLines Return the lines of head that are neither blank nor comments.
+func dataLines(head []byte) []string {
+	head = bytes.TrimPrefix(head, []byte(utf8BOM))
+	var lines []string
+	for _, line := range strings.Split(string(head), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,220 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"text/tabwriter"
+)
+
+// Kinds of range differences.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// FieldChange Define a field whose value differs between two metas.
+type FieldChange struct {
+	Column string
+	Old    string
+	New    string
+}
+
+// RangeDiff Define a range that differs between two datasets.
+type RangeDiff struct {
+	Family string
+	Start  net.IP
+	End    net.IP
+	Kind   string // DiffAdded, DiffRemoved or DiffChanged
+	Old    *Meta  // Meta of the old dataset, nil when added
+	New    *Meta  // Meta of the new dataset, nil when removed
+	Fields []FieldChange
+}
+
+// CountryDiff Define the number of differing ranges of a country.
+// Changed ranges count for both their old and new country.
+type CountryDiff struct {
+	Added   int
+	Removed int
+	Changed int
+}
+
+// FamilyDiff Define the address counts of a family, IPv6 addresses are
+// counted in /64 networks.
+type FamilyDiff struct {
+	Addresses      float64 // Addresses of the old dataset
+	CountryChanged float64 // Addresses of the old dataset whose country changed
+}
+
+// DiffReport Define the differences between two datasets.
+type DiffReport struct {
+	Ranges    []RangeDiff
+	Added     int
+	Removed   int
+	Changed   int
+	ByCountry map[string]*CountryDiff
+	Families  map[string]*FamilyDiff
+}
+
+// Diff Compare two stores and report the ranges added, removed and changed
+// from old to cur. Adjacent segments with the same difference are reported
+// as one range.
+func Diff(old, cur *Store) *DiffReport {
+	r := &DiffReport{
+		ByCountry: make(map[string]*CountryDiff),
+		Families:  make(map[string]*FamilyDiff),
+	}
+	for _, family := range []string{IPV4, IPV6} {
+		fd := &FamilyDiff{}
+		r.Families[family] = fd
+		var pending *RangeDiff
+		var pendingEnd uint64
+		_ = segments(family, []*Store{old, cur}, func(start, end uint64, covering []*Meta) error {
+			o, n := covering[0], covering[1]
+			size := float64(end-start) + 1
+			if o != nil {
+				fd.Addresses += size
+				if n != nil && o.Country != n.Country {
+					fd.CountryChanged += size
+				}
+			}
+			if o != nil && n != nil && (o == n || o.Hash() == n.Hash()) {
+				return nil
+			}
+			if pending != nil && pendingEnd+1 == start && pending.Old == o && pending.New == n {
+				pending.End = indexIP(family, end, true)
+				pendingEnd = end
+				return nil
+			}
+			r.add(pending)
+			pending = &RangeDiff{
+				Family: family,
+				Start:  indexIP(family, start, false),
+				End:    indexIP(family, end, true),
+				Old:    o,
+				New:    n,
+			}
+			pendingEnd = end
+			return nil
+		})
+		r.add(pending)
+	}
+	return r
+}
+
+// add Classify a range difference and count it.
+func (r *DiffReport) add(d *RangeDiff) {
+	if d == nil {
+		return
+	}
+	switch {
+	case d.Old == nil:
+		d.Kind = DiffAdded
+		r.Added++
+		r.country(d.New.Country).Added++
+	case d.New == nil:
+		d.Kind = DiffRemoved
+		r.Removed++
+		r.country(d.Old.Country).Removed++
+	default:
+		d.Kind = DiffChanged
+		d.Fields = diffFields(d.Old, d.New)
+		r.Changed++
+		r.country(d.Old.Country).Changed++
+		if d.New.Country != d.Old.Country {
+			r.country(d.New.Country).Changed++
+		}
+	}
+	r.Ranges = append(r.Ranges, *d)
+}
+
+func (r *DiffReport) country(name string) *CountryDiff {
+	cd, ok := r.ByCountry[name]
+	if !ok {
+		cd = &CountryDiff{}
+		r.ByCountry[name] = cd
+	}
+	return cd
+}
+
+// CountryChangeRatio Return the share of the addresses of the family in the
+// old dataset whose country changed, between 0 and 1.
+func (r *DiffReport) CountryChangeRatio(family string) float64 {
+	fd, ok := r.Families[family]
+	if !ok || fd.Addresses == 0 {
+		return 0
+	}
+	return fd.CountryChanged / fd.Addresses
+}
+
+// Render Write the report as text tables, listing at most limit ranges,
+// all of them when limit is negative.
+func (r *DiffReport) Render(w io.Writer, limit int) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "added\tremoved\tchanged\tv4 country changed\tv6 country changed\n")
+	_, _ = fmt.Fprintf(tw, "%d\t%d\t%d\t%.4f%%\t%.4f%%\n\n", r.Added, r.Removed, r.Changed,
+		r.CountryChangeRatio(IPV4)*100, r.CountryChangeRatio(IPV6)*100)
+
+	countries := make([]string, 0, len(r.ByCountry))
+	for c := range r.ByCountry {
+		countries = append(countries, c)
+	}
+	sort.Strings(countries)
+	_, _ = fmt.Fprintf(tw, "country\tadded\tremoved\tchanged\n")
+	for _, c := range countries {
+		cd := r.ByCountry[c]
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", textField(c), cd.Added, cd.Removed, cd.Changed)
+	}
+
+	if limit != 0 && len(r.Ranges) > 0 {
+		_, _ = fmt.Fprintf(tw, "\nkind\tstart\tend\tchanges\n")
+		for i, d := range r.Ranges {
+			if limit > 0 && i >= limit {
+				_, _ = fmt.Fprintf(tw, "... %d more\n", len(r.Ranges)-limit)
+				break
+			}
+			changes := ""
+			switch d.Kind {
+			case DiffAdded:
+				changes = textField(d.New.Country)
+			case DiffRemoved:
+				changes = textField(d.Old.Country)
+			default:
+				for j, fc := range d.Fields {
+					if j > 0 {
+						changes += " "
+					}
+					changes += fmt.Sprintf("%s:%q->%q", fc.Column, fc.Old, fc.New)
+				}
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.Kind, d.Start, d.End, changes)
+		}
+	}
+	return tw.Flush()
+}
+
+// diffFields Return the fields that differ between two metas.
+func diffFields(o, n *Meta) []FieldChange {
+	attrs := make(Attrs)
+	for k := range o.Attrs {
+		attrs[k] = ""
+	}
+	for k := range n.Attrs {
+		attrs[k] = ""
+	}
+	var changes []FieldChange
+	for _, column := range append(append([]string{}, metaColumns...), attrs.keys()...) {
+		if ov, nv := o.Column(column), n.Column(column); ov != nv {
+			changes = append(changes, FieldChange{Column: column, Old: ov, New: nv})
+		}
+	}
+	return changes
+}
+
+// indexIP Return the address of an index as net.IP.
+func indexIP(family string, index uint64, last bool) net.IP {
+	return indexAddr(family, index, last).AsSlice()
+}
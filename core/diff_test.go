@@ -0,0 +1,55 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	cn, jp := &Meta{Country: "中国", City: "上海"}, &Meta{Country: "日本"}
+	ob := NewBuilder()
+	_ = ob.AddPrefix(netip.MustParsePrefix("10.0.0.0/24"), cn)
+	_ = ob.AddPrefix(netip.MustParsePrefix("10.0.1.0/24"), cn)
+	_ = ob.AddPrefix(netip.MustParsePrefix("10.0.2.0/23"), jp)
+	old, _ := ob.Build()
+
+	nb := NewBuilder()
+	_ = nb.AddPrefix(netip.MustParsePrefix("10.0.0.0/24"), &Meta{Country: "中国", City: "上海"})
+	_ = nb.AddPrefix(netip.MustParsePrefix("10.0.1.0/24"), &Meta{Country: "中国", City: "北京"})
+	_ = nb.AddPrefix(netip.MustParsePrefix("10.0.2.0/24"), cn)
+	_ = nb.AddPrefix(netip.MustParsePrefix("10.0.4.0/24"), jp)
+	cur, _ := nb.Build()
+
+	r := Diff(old, cur)
+	if r.Added != 1 || r.Removed != 1 || r.Changed != 2 || len(r.Ranges) != 4 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	want := []string{
+		"changed 10.0.1.0-10.0.1.255 [{city 上海 北京}]",
+		"changed 10.0.2.0-10.0.2.255 [{country 日本 中国} {city  上海}]",
+		"removed 10.0.3.0-10.0.3.255 []",
+		"added 10.0.4.0-10.0.4.255 []",
+	}
+	for i, d := range r.Ranges {
+		if got := fmt.Sprintf("%s %s-%s %v", d.Kind, d.Start, d.End, d.Fields); got != want[i] {
+			t.Errorf("range %d = %s, want %s", i, got, want[i])
+		}
+	}
+	if cd := r.ByCountry["日本"]; cd == nil || cd.Added != 1 || cd.Removed != 1 || cd.Changed != 1 {
+		t.Errorf("unexpected 日本 summary %+v", cd)
+	}
+	if ratio := r.CountryChangeRatio(IPV4); ratio != 0.25 {
+		t.Errorf("got country change ratio %g, want 0.25", ratio)
+	}
+
+	var buf strings.Builder
+	if err := r.Render(&buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "25.0000%") || !strings.Contains(buf.String(), "... 3 more") {
+		t.Errorf("unexpected rendering\n%s", buf.String())
+	}
+}
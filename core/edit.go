@@ -0,0 +1,277 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrUnsignedEdit Returned by Set and Delete on a store with
+// Option.TrustedKeys, whose data must all come from signed files.
+var ErrUnsignedEdit = errors.New("edit refused, the store only accepts signed data")
+
+// Set Assign the meta to every address of the prefix, splitting the ranges
+// it partially covers. Readers see either the old or the new ranges.
+// IPv6 prefixes longer than /64 are not supported.
+func (s *Store) Set(prefix netip.Prefix, meta *Meta) error {
+	if meta.Hash() == "" {
+		return errors.New("empty meta")
+	}
+	return s.edit(prefix, meta)
+}
+
+// Delete Remove every address of the prefix, splitting the ranges it
+// partially covers.
+func (s *Store) Delete(prefix netip.Prefix) error {
+	return s.edit(prefix, nil)
+}
+
+// SaveText Write the ranges of the family to the file in the ipip text
+// format. The file is replaced atomically.
+func (s *Store) SaveText(path string, family string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	if err = s.WriteText(f, family); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// edit Replace the ranges of the prefix by a range of meta, or remove them
+// when meta is nil.
+func (s *Store) edit(prefix netip.Prefix, meta *Meta) error {
+	if s.immutable {
+		return ErrImmutable
+	}
+	if !prefix.IsValid() {
+		return fmt.Errorf("invalid prefix %s", prefix)
+	}
+	prefix = prefix.Masked()
+	if !prefix.Addr().Unmap().Is4() && prefix.Bits() > 64 {
+		return fmt.Errorf("prefix %s is longer than /64", prefix)
+	}
+	started := time.Now()
+	defer s.deliverEvents()
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+	if len(s.opt.TrustedKeys) > 0 {
+		return ErrUnsignedEdit
+	}
+
+	if meta != nil {
+		// Later changes of the caller's meta must not reach the store, the
+		// callback fills Extends of its copy as it does for loaded metas.
+		meta = meta.clone()
+		if s.opt.CB != nil {
+			meta.Extends = s.opt.CB(meta)
+		}
+	}
+	old := s.snapshot()
+	snap := *old
+	if err := snap.splice(prefix.Addr(), lastAddr(prefix), meta); err != nil {
+		return err
+	}
+	// Edits change the published version in place
+	version := s.Version()
+	s.queueEvent(old, &snap, ReloadEvent{OldVersion: version, NewVersion: version, Report: s.Report(), Duration: time.Since(started)})
+	s.publish(&snap)
+	return nil
+}
+
+// snapshot Define the ranges and metas of a store at one point in time.
+// The lists of a published snapshot are never modified, edits build new
+// lists and publish them.
+type snapshot struct {
+	ipv4EntityList []*IPV4Entity
+	ipv6EntityList []*IPV6Entity
+	v4MateList     []*Meta
+	v6MateList     []*Meta
+	v4MetaTable    map[string]uint32 // Index of v4MateList by hash, built by splice
+	v6MetaTable    map[string]uint32 // Index of v6MateList by hash, built by splice
+	info           Info              // Metadata of the dataset
+}
+
+// snapshot Return the current ranges of the store. They are read under mu,
+// which publish holds, so that both families and the metadata come from
+// the same version.
+func (s *Store) snapshot() *snapshot {
+	snap := &snapshot{}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.v4Mu.RLock()
+	snap.ipv4EntityList, snap.v4MateList = s.ipv4EntityList, s.v4MateList
+	s.v4Mu.RUnlock()
+	s.v6Mu.RLock()
+	snap.ipv6EntityList, snap.v6MateList = s.ipv6EntityList, s.v6MateList
+	s.v6Mu.RUnlock()
+	snap.info = s.info
+	return snap
+}
+
+// publish Make the snapshot the ranges of the published version. The
+// caller holds editMu.
+func (s *Store) publish(snap *snapshot) {
+	s.mu.Lock()
+	s.info = snap.info
+	if len(s.versions) > 0 {
+		// The hash tables are only needed while splicing
+		s.versions[s.current].snap = &snapshot{
+			ipv4EntityList: snap.ipv4EntityList,
+			ipv6EntityList: snap.ipv6EntityList,
+			v4MateList:     snap.v4MateList,
+			v6MateList:     snap.v6MateList,
+			info:           snap.info,
+		}
+	}
+	s.v4Mu.Lock()
+	s.ipv4EntityList, s.v4MateList = snap.ipv4EntityList, snap.v4MateList
+	s.v4Mu.Unlock()
+	s.v6Mu.Lock()
+	s.ipv6EntityList, s.v6MateList = snap.ipv6EntityList, snap.v6MateList
+	s.v6Mu.Unlock()
+	s.mu.Unlock()
+}
+
+// store Return a read only store holding the snapshot.
+func (snap *snapshot) store() *Store {
+	return &Store{
+		ipv4EntityList: snap.ipv4EntityList,
+		ipv6EntityList: snap.ipv6EntityList,
+		v4MateList:     snap.v4MateList,
+		v6MateList:     snap.v6MateList,
+		info:           snap.info,
+		immutable:      true,
+	}
+}
+
+// splice Cover the range from start to end by meta only, or by nothing
+// when meta is nil. IPv6 ranges are cut at their upper 64 bits.
+func (snap *snapshot) splice(start, end netip.Addr, meta *Meta) error {
+	start, end = start.Unmap(), end.Unmap()
+	if !start.IsValid() || !end.IsValid() || start.Is4() != end.Is4() || end.Less(start) {
+		return fmt.Errorf("bad IP range %s-%s", start, end)
+	}
+
+	if start.Is4() {
+		s4, e4 := start.As4(), end.As4()
+		var entity *IPV4Entity
+		if meta != nil {
+			var index uint32
+			snap.v4MateList, index = withMeta(snap.v4MateList, &snap.v4MetaTable, meta)
+			entity = &IPV4Entity{
+				startIndex: binary.BigEndian.Uint32(s4[:]),
+				endIndex:   binary.BigEndian.Uint32(e4[:]),
+				metaIndex:  index,
+			}
+		}
+		snap.ipv4EntityList = spliceV4(snap.ipv4EntityList, binary.BigEndian.Uint32(s4[:]), binary.BigEndian.Uint32(e4[:]), entity)
+		return nil
+	}
+
+	s16, e16 := start.As16(), end.As16()
+	var entity *IPV6Entity
+	if meta != nil {
+		var index uint32
+		snap.v6MateList, index = withMeta(snap.v6MateList, &snap.v6MetaTable, meta)
+		entity = &IPV6Entity{
+			startIndex: binary.BigEndian.Uint64(s16[:]),
+			endIndex:   binary.BigEndian.Uint64(e16[:]),
+			metaIndex:  index,
+		}
+	}
+	snap.ipv6EntityList = spliceV6(snap.ipv6EntityList, binary.BigEndian.Uint64(s16[:]), binary.BigEndian.Uint64(e16[:]), entity)
+	return nil
+}
+
+// withMeta Return the meta list holding meta and its index, an identical
+// meta already in the list is reused. The list is copied before growing,
+// as it may be shared with readers and with the other family. table maps
+// the hashes of the metas of the list to their index, it is built on first
+// use.
+func withMeta(metas []*Meta, table *map[string]uint32, meta *Meta) ([]*Meta, uint32) {
+	if *table == nil {
+		*table = make(map[string]uint32, len(metas))
+		for i, m := range metas {
+			if _, ok := (*table)[m.Hash()]; !ok {
+				(*table)[m.Hash()] = uint32(i)
+			}
+		}
+	}
+	fp := meta.Hash()
+	if index, ok := (*table)[fp]; ok {
+		return metas, index
+	}
+	index := uint32(len(metas))
+	(*table)[fp] = index
+	return append(metas[:len(metas):len(metas)], meta), index
+}
+
+// spliceV4 Return a new sorted list where the range from start to end is
+// covered by entity only, or by nothing if entity is nil.
+func spliceV4(entities []*IPV4Entity, start, end uint32, entity *IPV4Entity) []*IPV4Entity {
+	list := make([]*IPV4Entity, 0, len(entities)+2)
+	inserted := entity == nil
+	for _, e := range entities {
+		if e.endIndex < start {
+			list = append(list, e)
+			continue
+		}
+		if e.startIndex < start {
+			list = append(list, &IPV4Entity{startIndex: e.startIndex, endIndex: start - 1, metaIndex: e.metaIndex})
+		}
+		if !inserted {
+			list = append(list, entity)
+			inserted = true
+		}
+		if e.startIndex > end {
+			list = append(list, e)
+		} else if e.endIndex > end {
+			list = append(list, &IPV4Entity{startIndex: end + 1, endIndex: e.endIndex, metaIndex: e.metaIndex})
+		}
+	}
+	if !inserted {
+		list = append(list, entity)
+	}
+	return list
+}
+
+// spliceV6 Return a new sorted list where the range from start to end is
+// covered by entity only, or by nothing if entity is nil.
+func spliceV6(entities []*IPV6Entity, start, end uint64, entity *IPV6Entity) []*IPV6Entity {
+	list := make([]*IPV6Entity, 0, len(entities)+2)
+	inserted := entity == nil
+	for _, e := range entities {
+		if e.endIndex < start {
+			list = append(list, e)
+			continue
+		}
+		if e.startIndex < start {
+			list = append(list, &IPV6Entity{startIndex: e.startIndex, endIndex: start - 1, metaIndex: e.metaIndex})
+		}
+		if !inserted {
+			list = append(list, entity)
+			inserted = true
+		}
+		if e.startIndex > end {
+			list = append(list, e)
+		} else if e.endIndex > end {
+			list = append(list, &IPV6Entity{startIndex: end + 1, endIndex: e.endIndex, metaIndex: e.metaIndex})
+		}
+	}
+	if !inserted {
+		list = append(list, entity)
+	}
+	return list
+}
@@ -0,0 +1,98 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestSetDelete(t *testing.T) {
+	cn, jp, us := &Meta{Country: "中国"}, &Meta{Country: "日本"}, &Meta{Country: "美国"}
+	b := NewBuilder()
+	_ = b.AddPrefix(netip.MustParsePrefix("10.0.0.0/22"), cn)
+	_ = b.AddPrefix(netip.MustParsePrefix("10.0.4.0/24"), jp)
+	_ = b.AddPrefix(netip.MustParsePrefix("2001:db8::/32"), cn)
+	built, _ := b.Build()
+	if err := built.Set(netip.MustParsePrefix("10.0.1.0/24"), jp); err != ErrImmutable {
+		t.Errorf("got %v, want ErrImmutable", err)
+	}
+
+	// an editable copy of the built store
+	st := NewStore()
+	var buf strings.Builder
+	_ = built.WriteText(&buf, IPV4)
+	_ = st.UnmarshalFrom(strings.NewReader(buf.String()), IPV4)
+	buf.Reset()
+	_ = built.WriteText(&buf, IPV6)
+	_ = st.UnmarshalFrom(strings.NewReader(buf.String()), IPV6)
+
+	if err := st.Set(netip.MustParsePrefix("10.0.1.0/24"), us); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Delete(netip.MustParsePrefix("10.0.3.128/25")); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Set(netip.MustParsePrefix("10.0.8.0/24"), us); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Set(netip.MustParsePrefix("2001:db8:1::/48"), jp); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Set(netip.MustParsePrefix("2001:db8::1/128"), jp); err == nil {
+		t.Error("expected error for IPv6 prefix longer than /64")
+	}
+
+	var got []string
+	st.Walk(IPV4, func(start, end net.IP, meta *Meta) bool {
+		got = append(got, start.String()+"-"+end.String()+" "+meta.Country)
+		return true
+	})
+	want := []string{
+		"10.0.0.0-10.0.0.255 中国",
+		"10.0.1.0-10.0.1.255 美国",
+		"10.0.2.0-10.0.3.127 中国",
+		"10.0.4.0-10.0.4.255 日本",
+		"10.0.8.0-10.0.8.255 美国",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got ranges\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for addr, country := range map[string]string{
+		"2001:db8::1": "中国", "2001:db8:1::1": "日本", "2001:db8:2::1": "中国", "10.0.3.200": "",
+	} {
+		if m := st.Search(net.ParseIP(addr)); (m == nil && country != "") || (m != nil && m.Country != country) {
+			t.Errorf("Search(%s) = %v, want %s", addr, m, country)
+		}
+	}
+
+	path := t.TempDir() + "/v4.txt"
+	if err := st.SaveText(path, IPV4); err != nil {
+		t.Fatal(err)
+	}
+	saved := NewStore()
+	if err := saved.LoadData(Option{Files: []FileInfo{{Path: path, Type: IPV4}}}); err != nil {
+		t.Fatal(err)
+	}
+	if saved.IPV4EntityCount() != len(want) || saved.Search(net.ParseIP("10.0.1.1")).Country != "美国" {
+		t.Error("saved ranges differ")
+	}
+
+	// the store keeps its own copy of the metas
+	us.Country = "英国"
+	if m := st.Search(net.ParseIP("10.0.1.1")); m == us || m.Country != "美国" {
+		t.Errorf("edited store changed with the set meta, got %v", m)
+	}
+	us.Country = "美国"
+
+	// metas added by Set go through the callback like loaded ones
+	cb := NewStore()
+	cb.opt.CB = func(meta *Meta) interface{} { return "extends of " + meta.Country }
+	if err := cb.Set(netip.MustParsePrefix("10.0.0.0/24"), jp); err != nil {
+		t.Fatal(err)
+	}
+	if m := cb.Search(net.ParseIP("10.0.0.1")); m == nil || m.Extends != "extends of 日本" || jp.Extends != nil {
+		t.Errorf("unexpected meta %v, caller's extends %v", m, jp.Extends)
+	}
+}
@@ -0,0 +1,367 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// metaColumns Columns of the text form of a meta, in data file order,
+// followed by the type and comment columns.
+var metaColumns = append(append([]string{}, V6Columns[1:]...), ColType, ColComment)
+
+// metaJSON JSON form of a meta, with stable snake_case keys.
+type metaJSON struct {
+	Country        string  `json:"country"`
+	Province       string  `json:"province"`
+	City           string  `json:"city"`
+	Region         string  `json:"region"`
+	OwnerDomain    string  `json:"owner_domain"`
+	IspDomain      string  `json:"isp_domain"`
+	ChinaAdminCode int32   `json:"china_admin_code"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	Timezone       string  `json:"timezone"`
+	CountryCode    string  `json:"country_code"`
+	Asn            []int64 `json:"asn"`
+	UsageType      string  `json:"usage_type"`
+	Line           string  `json:"line"`
+	Type           *string `json:"type"`
+	Comment        *string `json:"comment"`
+	Attrs          Attrs   `json:"attrs,omitempty"`
+	Source         string  `json:"source,omitempty"`
+	Stale          bool    `json:"stale,omitempty"`
+}
+
+// MarshalJSON Implement json.Marshaler, Extends is not serialized.
+func (m Meta) MarshalJSON() ([]byte, error) {
+	v := metaJSON{
+		Country:        m.Country,
+		Province:       m.Province,
+		City:           m.City,
+		Region:         m.Region,
+		OwnerDomain:    m.OwnerDomain,
+		IspDomain:      m.IspDomain,
+		ChinaAdminCode: m.ChinaAdminCode,
+		Latitude:       m.Latitude,
+		Longitude:      m.Longitude,
+		Timezone:       m.Timezone,
+		CountryCode:    m.CountryCode,
+		Asn:            m.Asn,
+		UsageType:      m.UsageType,
+		Line:           m.Line,
+		Type:           m.Type,
+		Comment:        m.Comment,
+		Attrs:          m.Attrs,
+		Source:         m.Source,
+		Stale:          m.Stale,
+	}
+	if v.Asn == nil {
+		v.Asn = []int64{}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON Implement json.Unmarshaler.
+func (m *Meta) UnmarshalJSON(data []byte) error {
+	var v metaJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*m = Meta{
+		Country:        v.Country,
+		Province:       v.Province,
+		City:           v.City,
+		Region:         v.Region,
+		OwnerDomain:    v.OwnerDomain,
+		IspDomain:      v.IspDomain,
+		ChinaAdminCode: v.ChinaAdminCode,
+		Latitude:       v.Latitude,
+		Longitude:      v.Longitude,
+		Timezone:       v.Timezone,
+		CountryCode:    v.CountryCode,
+		Asn:            v.Asn,
+		UsageType:      v.UsageType,
+		Line:           v.Line,
+		Type:           v.Type,
+		Comment:        v.Comment,
+		Attrs:          v.Attrs,
+		Source:         v.Source,
+		Stale:          v.Stale,
+	}
+	if len(m.Asn) == 0 {
+		m.Asn = nil
+	}
+	return nil
+}
+
+// textEscaper and textUnescaper Escape backslashes, tabs and line breaks
+// in the fields of the text form.
+var (
+	textEscaper   = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+	textUnescaper = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r")
+)
+
+// Reserved fields of the text form after the attributes, attribute names
+// can't start with their prefix.
+const (
+	textSourceField = "@source="
+	textStaleField  = "@stale"
+)
+
+// MarshalText Implement encoding.TextMarshaler. The text form is the tab
+// separated meta columns of the data files, country to comment, with * for
+// empty fields, followed by one key=value field per custom attribute, and
+// by @source=name and @stale when the meta has them. Backslashes, tabs and
+// line breaks in values are escaped as \\, \t, \n and \r.
+func (m Meta) MarshalText() ([]byte, error) {
+	fields := make([]string, 0, len(metaColumns)+len(m.Attrs)+2)
+	for _, name := range metaColumns {
+		fields = append(fields, textEscaper.Replace(textField(m.Column(name))))
+	}
+	for _, k := range m.Attrs.keys() {
+		if strings.ContainsAny(k, "=\t\n\r\\") || strings.HasPrefix(k, "@") {
+			return nil, fmt.Errorf("invalid attribute name %q", k)
+		}
+		fields = append(fields, k+"="+textEscaper.Replace(m.Attrs[k]))
+	}
+	if m.Source != "" {
+		fields = append(fields, textSourceField+textEscaper.Replace(m.Source))
+	}
+	if m.Stale {
+		fields = append(fields, textStaleField)
+	}
+	return []byte(strings.Join(fields, "\t")), nil
+}
+
+// dataText Return the text form without the source and stale flag, for
+// checksums and patches, which cover the data and not where it comes from.
+func (m Meta) dataText() ([]byte, error) {
+	m.Source, m.Stale = "", false
+	return m.MarshalText()
+}
+
+// UnmarshalText Implement encoding.TextUnmarshaler.
+func (m *Meta) UnmarshalText(text []byte) error {
+	fields := splitRow(string(text))
+	for i, field := range fields {
+		fields[i] = textUnescaper.Replace(field)
+	}
+	if len(fields) < len(metaColumns)-2 {
+		return fmt.Errorf("expected %d fields, got %d", len(metaColumns), len(fields))
+	}
+	r := &RowMeta{}
+	n := len(fields)
+	if n > len(metaColumns) {
+		n = len(metaColumns)
+	}
+	if err := r.UnmarshalColumns(fields[:n], metaColumns); err != nil {
+		return err
+	}
+	var source string
+	var stale bool
+	for _, field := range fields[n:] {
+		switch {
+		case strings.HasPrefix(field, textSourceField):
+			source = strings.TrimPrefix(field, textSourceField)
+			continue
+		case field == textStaleField:
+			stale = true
+			continue
+		}
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			return fmt.Errorf("invalid attribute %q", field)
+		}
+		if r.Attrs == nil {
+			r.Attrs = make(Attrs)
+		}
+		r.Attrs[k] = v
+	}
+	*m = *r.Meta()
+	m.Source, m.Stale = source, stale
+	return nil
+}
+
+// binaryVersion Version of the binary form of a meta, version 1 lacks the
+// source and stale flag.
+const binaryVersion = 2
+
+// MarshalBinary Implement encoding.BinaryMarshaler with a compact form
+// suited to caching lookup results, Extends is not serialized.
+func (m Meta) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 64)
+	b = append(b, binaryVersion)
+	for _, s := range []string{m.Country, m.Province, m.City, m.Region,
+		m.OwnerDomain, m.IspDomain, m.Timezone, m.CountryCode, m.UsageType, m.Line} {
+		b = appendString(b, s)
+	}
+	b = binary.AppendVarint(b, int64(m.ChinaAdminCode))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(m.Latitude))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(m.Longitude))
+	b = binary.AppendUvarint(b, uint64(len(m.Asn)))
+	for _, v := range m.Asn {
+		b = binary.AppendVarint(b, v)
+	}
+	b = appendOptionalString(b, m.Type)
+	b = appendOptionalString(b, m.Comment)
+	b = binary.AppendUvarint(b, uint64(len(m.Attrs)))
+	for _, k := range m.Attrs.keys() {
+		b = appendString(appendString(b, k), m.Attrs[k])
+	}
+	b = appendString(b, m.Source)
+	if m.Stale {
+		return append(b, 1), nil
+	}
+	return append(b, 0), nil
+}
+
+// UnmarshalBinary Implement encoding.BinaryUnmarshaler.
+func (m *Meta) UnmarshalBinary(data []byte) error {
+	d := binaryDecoder{buf: data}
+	version := d.byte()
+	if version < 1 || version > binaryVersion {
+		return fmt.Errorf("unsupported meta binary version %d", version)
+	}
+	v := Meta{}
+	for _, s := range []*string{&v.Country, &v.Province, &v.City, &v.Region,
+		&v.OwnerDomain, &v.IspDomain, &v.Timezone, &v.CountryCode, &v.UsageType, &v.Line} {
+		*s = d.string()
+	}
+	v.ChinaAdminCode = int32(d.varint())
+	v.Latitude = math.Float64frombits(d.uint64())
+	v.Longitude = math.Float64frombits(d.uint64())
+	if n := d.count(); n > 0 {
+		v.Asn = make([]int64, n)
+		for i := range v.Asn {
+			v.Asn[i] = d.varint()
+		}
+	}
+	v.Type = d.optionalString()
+	v.Comment = d.optionalString()
+	if n := d.count(); n > 0 {
+		v.Attrs = make(Attrs, n)
+		for i := 0; i < n; i++ {
+			k := d.string()
+			v.Attrs[k] = d.string()
+		}
+	}
+	if version >= 2 {
+		v.Source = d.string()
+		v.Stale = d.byte() == 1
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buf) > 0 {
+		return errors.New("trailing data after meta")
+	}
+	*m = v
+	return nil
+}
+
+// keys Return the sorted attribute names.
+func (a Attrs) keys() []string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendOptionalString(b []byte, s *string) []byte {
+	if s == nil {
+		return append(b, 0)
+	}
+	return appendString(append(b, 1), *s)
+}
+
+// binaryDecoder Read the binary form of a meta, the first error is kept
+// and every later read returns zero values.
+type binaryDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *binaryDecoder) fail() {
+	if d.err == nil {
+		d.err = errors.New("truncated meta binary data")
+	}
+	d.buf = nil
+}
+
+func (d *binaryDecoder) byte() byte {
+	if len(d.buf) < 1 {
+		d.fail()
+		return 0
+	}
+	v := d.buf[0]
+	d.buf = d.buf[1:]
+	return v
+}
+
+func (d *binaryDecoder) uint64() uint64 {
+	if len(d.buf) < 8 {
+		d.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint64(d.buf)
+	d.buf = d.buf[8:]
+	return v
+}
+
+func (d *binaryDecoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// count Read a length, bounded by the remaining data.
+func (d *binaryDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *binaryDecoder) string() string {
+	n := d.count()
+	v := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) optionalString() *string {
+	if d.byte() == 0 {
+		return nil
+	}
+	v := d.string()
+	return &v
+}
@@ -0,0 +1,151 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testMeta() *Meta {
+	typ, comment := "IDC", "core dc"
+	return &Meta{
+		Country:        "中国",
+		Province:       "上海",
+		City:           "上海",
+		OwnerDomain:    "example.com",
+		IspDomain:      "电信",
+		ChinaAdminCode: 310000,
+		Latitude:       31.231706,
+		Longitude:      121.472644,
+		Timezone:       "Asia/Shanghai",
+		CountryCode:    "CN",
+		Asn:            []int64{4812, 4134},
+		Line:           "电信",
+		Type:           &typ,
+		Comment:        &comment,
+		Attrs:          Attrs{"dc_tag": "sh-01", "risk_tier": "2"},
+	}
+}
+
+func TestMetaJSON(t *testing.T) {
+	m := testMeta()
+	m.WithExtends("not serialized")
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"country":"中国"`, `"china_admin_code":310000`, `"asn":[4812,4134]`,
+		`"country_code":"CN"`, `"type":"IDC"`, `"attrs":{"dc_tag":"sh-01","risk_tier":"2"}`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("%s missing from %s", key, data)
+		}
+	}
+	if strings.Contains(string(data), "Extends") || strings.Contains(string(data), "not serialized") {
+		t.Errorf("extends must not be serialized, %s", data)
+	}
+
+	var got Meta
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	m.Extends = nil
+	if !reflect.DeepEqual(m, &got) {
+		t.Errorf("got %v, want %v", &got, m)
+	}
+
+	// empty metas keep every key
+	if data, _ = json.Marshal(Meta{}); !strings.Contains(string(data), `"asn":[]`) || !strings.Contains(string(data), `"type":null`) {
+		t.Errorf("unexpected empty meta %s", data)
+	}
+}
+
+func TestMetaText(t *testing.T) {
+	m := testMeta()
+	text, err := m.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "中国\t上海\t上海\t*\texample.com\t电信\t310000\t31.231706\t121.472644\tAsia/Shanghai\tCN\t4812,4134\t*\t电信\tIDC\tcore dc\tdc_tag=sh-01\trisk_tier=2"
+	if string(text) != want {
+		t.Fatalf("got %q, want %q", text, want)
+	}
+	var got Meta
+	if err = got.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, &got) {
+		t.Errorf("got %v, want %v", &got, m)
+	}
+
+	// the source and stale flag follow the attributes
+	m.Source, m.Stale = "office", true
+	if text, err = m.MarshalText(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(text), "\trisk_tier=2\t@source=office\t@stale") {
+		t.Fatalf("unexpected text %q", text)
+	}
+	if err = got.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, &got) {
+		t.Errorf("got %v, want %v", &got, m)
+	}
+	if data, _ := m.dataText(); strings.Contains(string(data), "@") {
+		t.Errorf("unexpected data text %q", data)
+	}
+	m.Source, m.Stale = "", false
+
+	if err = got.UnmarshalText([]byte("中国\t上海")); err == nil {
+		t.Error("expected error for short text")
+	}
+
+	// Marshal uses the text form, values are escaped
+	m.City, m.Attrs["note"] = "a\tb\\c", "x\ny"
+	if text, err = m.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(text), "\t") != 18 || strings.Contains(string(text), "\n") ||
+		!strings.Contains(string(text), "\ta\\tb\\\\c\t") || !strings.Contains(string(text), `note=x\ny`) {
+		t.Fatalf("unexpected escaped text %q", text)
+	}
+	if err = got.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, &got) {
+		t.Errorf("got %v, want %v", &got, m)
+	}
+}
+
+func TestMetaBinary(t *testing.T) {
+	sourced := testMeta()
+	sourced.Source, sourced.Stale = "office", true
+	for _, m := range []*Meta{testMeta(), {}, sourced} {
+		data, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Meta
+		if err = got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, &got) {
+			t.Errorf("got %v, want %v", &got, m)
+		}
+		for i := 0; i < len(data); i++ {
+			if err = got.UnmarshalBinary(data[:i]); err == nil {
+				t.Fatalf("expected error for data truncated at %d", i)
+			}
+		}
+	}
+
+	// version 1 lacks the source and stale flag
+	data, _ := testMeta().MarshalBinary()
+	data = append([]byte{1}, data[1:len(data)-2]...)
+	var got Meta
+	if err := got.UnmarshalBinary(data); err != nil || got.Hash() != testMeta().Hash() {
+		t.Errorf("unexpected version 1 meta %v, %v", &got, err)
+	}
+}
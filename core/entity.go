@@ -34,3 +34,13 @@ func (i *IPV6Entity) StartIndex() uint64 {
 func (i *IPV6Entity) EndIndex() uint64 {
 	return i.endIndex
 }
+
+// meta meta index
+func (i *IPV4Entity) meta() uint32 {
+	return i.metaIndex
+}
+
+// meta meta index
+func (i *IPV6Entity) meta() uint32 {
+	return i.metaIndex
+}
@@ -0,0 +1,283 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/universal-fraternity/ipip/utils"
+)
+
+// Export formats.
+const (
+	ExportJSON = "jsonl" // One JSON object per line (NDJSON)
+	ExportCSV  = "csv"   // Comma separated values with a header row
+	ExportTSV  = "tsv"   // Tab separated values with a header row, tabs and line breaks escaped
+)
+
+// ExportOption Define what Export writes and how.
+type ExportOption struct {
+	Format    string   // ExportJSON, ExportCSV or ExportTSV
+	Columns   []string // Meta columns and attributes to write, all of them by default
+	CIDR      bool     // Write ranges as CIDRs instead of start/end pairs
+	Families  []string // Families to export, IPV4 and IPV6 by default
+	Countries []string // Only export ranges of these countries or country codes
+	Info      bool     // Write the declared metadata of the store first, see Info
+}
+
+// Export Write every range of the store with its meta in a bulk format.
+// The range columns come first: cidr, or start_ip and end_ip. With Info,
+// the declared metadata and the exported row counts are written before the
+// header row, as "#@key: value" lines for CSV and TSV and as an
+// {"info": {...}} line for JSON, which bulk loaders don't expect. TSV
+// values escape backslashes, tabs and line breaks as \\, \t, \n and \r,
+// like Meta.MarshalText.
+func (s *Store) Export(w io.Writer, opt ExportOption) error {
+	families := opt.Families
+	if len(families) == 0 {
+		families = []string{IPV4, IPV6}
+	}
+	for _, family := range families {
+		if family != IPV4 && family != IPV6 {
+			return fmt.Errorf("unknown export family %q", family)
+		}
+	}
+	// One snapshot for the metadata, the columns and the rows
+	view := s.snapshot().store()
+	columns := view.exportColumns(families)
+	if len(opt.Columns) > 0 {
+		known := make(map[string]bool, len(columns))
+		for _, name := range columns {
+			known[name] = true
+		}
+		for _, name := range opt.Columns {
+			if !known[name] {
+				return fmt.Errorf("unknown export column %q", name)
+			}
+		}
+		columns = opt.Columns
+	}
+	rangeColumns := []string{ColStartIP, ColEndIP}
+	if opt.CIDR {
+		rangeColumns = []string{ColCIDR}
+	}
+
+	var ew exportWriter
+	switch opt.Format {
+	case ExportJSON:
+		ew = &jsonExportWriter{w: bufio.NewWriter(w)}
+	case ExportCSV:
+		ew = &csvExportWriter{raw: w, w: csv.NewWriter(w)}
+	case ExportTSV:
+		ew = &tsvExportWriter{w: bufio.NewWriter(w)}
+	default:
+		return fmt.Errorf("unknown export format %q", opt.Format)
+	}
+
+	countries := make(map[string]bool, len(opt.Countries))
+	for _, c := range opt.Countries {
+		countries[strings.ToUpper(c)] = true
+	}
+	// rows passes every exported row to fn
+	rows := func(fn func(family string, ranges []string, meta *Meta) error) error {
+		var err error
+		for _, family := range families {
+			view.Walk(family, func(start, end net.IP, meta *Meta) bool {
+				if len(countries) > 0 && !countries[strings.ToUpper(meta.Country)] &&
+					!countries[strings.ToUpper(meta.CountryCode)] {
+					return true
+				}
+				if !opt.CIDR {
+					err = fn(family, []string{start.String(), end.String()}, meta)
+					return err == nil
+				}
+				for _, cidr := range utils.RangeToCIDRs(start, end) {
+					if err = fn(family, []string{cidr.String()}, meta); err != nil {
+						return false
+					}
+				}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if info := view.Info(); opt.Info && info.declared() {
+		info.IPV4Count, info.IPV6Count = 0, 0
+		_ = rows(func(family string, _ []string, _ *Meta) error {
+			if family == IPV4 {
+				info.IPV4Count++
+			} else {
+				info.IPV6Count++
+			}
+			return nil
+		})
+		if err := ew.info(info); err != nil {
+			return err
+		}
+	}
+	if err := ew.header(append(append([]string{}, rangeColumns...), columns...)); err != nil {
+		return err
+	}
+	if err := rows(func(_ string, ranges []string, meta *Meta) error {
+		return ew.row(ranges, columns, meta)
+	}); err != nil {
+		return err
+	}
+	return ew.flush()
+}
+
+// exportColumns Return all meta columns followed by the attribute names
+// used by the families.
+func (s *Store) exportColumns(families []string) []string {
+	columns := append([]string{}, metaColumns...)
+	seen := make(map[string]bool)
+	for _, family := range families {
+		for _, name := range s.attrNames(family) {
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+	}
+	return columns
+}
+
+// exportWriter Writer of one export format.
+type exportWriter interface {
+	info(i Info) error
+	header(names []string) error
+	row(ranges []string, columns []string, meta *Meta) error
+	flush() error
+}
+
+type csvExportWriter struct {
+	raw io.Writer
+	w   *csv.Writer
+}
+
+func (e *csvExportWriter) info(i Info) error {
+	return writeInfo(e.raw, i)
+}
+
+func (e *csvExportWriter) header(names []string) error {
+	return e.w.Write(names)
+}
+
+func (e *csvExportWriter) row(ranges []string, columns []string, meta *Meta) error {
+	record := append([]string{}, ranges...)
+	for _, name := range columns {
+		record = append(record, meta.Column(name))
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExportWriter) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// tsvExportWriter Writer of TSV rows. TSV has no quoting, the separators
+// are escaped in the values instead.
+type tsvExportWriter struct {
+	w *bufio.Writer
+}
+
+func (e *tsvExportWriter) info(i Info) error {
+	return writeInfo(e.w, i)
+}
+
+func (e *tsvExportWriter) header(names []string) error {
+	return e.write(names)
+}
+
+func (e *tsvExportWriter) row(ranges []string, columns []string, meta *Meta) error {
+	record := append([]string{}, ranges...)
+	for _, name := range columns {
+		record = append(record, meta.Column(name))
+	}
+	return e.write(record)
+}
+
+func (e *tsvExportWriter) write(record []string) error {
+	for i, v := range record {
+		if i > 0 {
+			_ = e.w.WriteByte('\t')
+		}
+		_, _ = textEscaper.WriteString(e.w, v)
+	}
+	return e.w.WriteByte('\n')
+}
+
+func (e *tsvExportWriter) flush() error {
+	return e.w.Flush()
+}
+
+type jsonExportWriter struct {
+	w     *bufio.Writer
+	names []string
+}
+
+func (e *jsonExportWriter) info(i Info) error {
+	data, err := json.Marshal(map[string]Info{"info": i})
+	if err != nil {
+		return err
+	}
+	_, _ = e.w.Write(data)
+	return e.w.WriteByte('\n')
+}
+
+func (e *jsonExportWriter) header(names []string) error {
+	e.names = names
+	return nil
+}
+
+func (e *jsonExportWriter) row(ranges []string, columns []string, meta *Meta) error {
+	obj := make(map[string]interface{}, len(e.names))
+	for i, v := range ranges {
+		obj[e.names[i]] = v
+	}
+	for _, name := range columns {
+		obj[name] = meta.jsonValue(name)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	_, _ = e.w.Write(data)
+	return e.w.WriteByte('\n')
+}
+
+func (e *jsonExportWriter) flush() error {
+	return e.w.Flush()
+}
+
+// jsonValue Return the typed value of the named column.
+func (m *Meta) jsonValue(name string) interface{} {
+	switch name {
+	case ColChinaAdminCode:
+		return m.ChinaAdminCode
+	case ColLatitude:
+		return m.Latitude
+	case ColLongitude:
+		return m.Longitude
+	case ColAsn:
+		if m.Asn == nil {
+			return []int64{}
+		}
+		return m.Asn
+	case ColType:
+		return m.Type
+	case ColComment:
+		return m.Comment
+	}
+	return m.Column(name)
+}
@@ -0,0 +1,88 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	st := NewStore()
+	st.opt.Schema = &Schema{Attrs: true}
+	v4 := "start_ip\tend_ip\tcountry\tcountry_code\tcity\tasn\tdc_tag\n" +
+		"10.0.0.0\t10.0.1.255\t中国\tCN\t上海\t4812,4134\tsh-01\n" +
+		"10.0.2.0\t10.0.2.255\t日本\tJP\t东京\t*\t*\n"
+	if err := st.UnmarshalFrom(strings.NewReader(v4), IPV4); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.UnmarshalFrom(strings.NewReader("cidr\tcountry\tcountry_code\n2001:db8::/32\t中国\tCN\n"), IPV6); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := st.Export(&buf, ExportOption{Format: ExportJSON}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected export %q", buf.String())
+	}
+	for _, want := range []string{`"start_ip":"10.0.0.0"`, `"end_ip":"10.0.1.255"`, `"asn":[4812,4134]`, `"dc_tag":"sh-01"`, `"latitude":0`} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("%s missing from %s", want, lines[0])
+		}
+	}
+	if !strings.Contains(lines[2], `"end_ip":"2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"`) {
+		t.Errorf("unexpected v6 line %s", lines[2])
+	}
+
+	buf.Reset()
+	if err := st.Export(&buf, ExportOption{
+		Format:    ExportCSV,
+		Columns:   []string{ColCountryCode, ColCity, "dc_tag"},
+		CIDR:      true,
+		Families:  []string{IPV4},
+		Countries: []string{"cn"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "cidr,country_code,city,dc_tag\n10.0.0.0/23,CN,上海,sh-01\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := st.Export(&buf, ExportOption{Format: ExportTSV, Columns: []string{ColCountry, ColAsn}, Countries: []string{"日本", "CN"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "start_ip\tend_ip\tcountry\tasn\n" +
+		"10.0.0.0\t10.0.1.255\t中国\t4812,4134\n" +
+		"10.0.2.0\t10.0.2.255\t日本\t\n" +
+		"2001:db8::\t2001:db8:ffff:ffff:ffff:ffff:ffff:ffff\t中国\t\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	// TSV values are escaped, never quoted
+	if err := st.Set(netip.MustParsePrefix("10.1.0.0/24"), &Meta{Country: "中国", City: "say \"hi\"\tnow"}); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := st.Export(&buf, ExportOption{Format: ExportTSV, Columns: []string{ColCity}, Countries: []string{"中国"}, Families: []string{IPV4}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "10.1.0.0\t10.1.0.255\tsay \"hi\"\\tnow\n") {
+		t.Errorf("unexpected tsv %q", buf.String())
+	}
+
+	if err := st.Export(&buf, ExportOption{Format: ExportTSV, Columns: []string{ColCity, "no_such_column"}}); err == nil {
+		t.Error("expected unknown column error")
+	}
+	if err := st.Export(&buf, ExportOption{Format: ExportTSV, Families: []string{"v4"}}); err == nil {
+		t.Error("expected unknown family error")
+	}
+	if err := st.Export(&buf, ExportOption{Format: "xml"}); err == nil {
+		t.Error("expected unknown format error")
+	}
+}
@@ -0,0 +1,238 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FetchRequest Define a request for a remote data file. ETag and
+// LastModified are the validators of the cached copy, if any.
+type FetchRequest struct {
+	URL          string
+	ETag         string
+	LastModified string
+}
+
+// FetchResponse Define the response to a FetchRequest. Body is nil when
+// NotModified is set, the cached copy is then still valid.
+type FetchResponse struct {
+	Body         io.ReadCloser
+	NotModified  bool
+	ETag         string
+	LastModified string
+}
+
+// Fetcher Define a source of remote data files, used for the FileInfo
+// paths starting with http:// or https://.
+type Fetcher interface {
+	Fetch(ctx context.Context, req *FetchRequest) (*FetchResponse, error)
+}
+
+// HTTPFetcher Fetcher using conditional HTTP requests. Failed requests are
+// retried with an exponential backoff, client errors are not retried.
+type HTTPFetcher struct {
+	Client  *http.Client  // Client with a Timeout of 5 minutes if nil
+	Retries int           // Number of retries after a failed request
+	Backoff time.Duration // Delay before the first retry, doubled at each retry, 1 second by default
+}
+
+// defaultFetchTimeout Time limit of a request of the default client,
+// including reading the body.
+const defaultFetchTimeout = 5 * time.Minute
+
+// defaultFetchClient Client of the HTTPFetcher without Client.
+var defaultFetchClient = &http.Client{Timeout: defaultFetchTimeout}
+
+// Fetch Send the request, retrying on network and server errors.
+func (f *HTTPFetcher) Fetch(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+	client := f.Client
+	if client == nil {
+		client = defaultFetchClient
+	}
+	backoff := f.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		resp, retry, err := f.fetch(ctx, client, req)
+		if err == nil || !retry || attempt >= f.Retries {
+			return resp, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff << attempt):
+		}
+	}
+}
+
+// fetch Send the request once, retry reports whether a failure may be
+// retried.
+func (f *HTTPFetcher) fetch(ctx context.Context, client *http.Client, req *FetchRequest) (resp *FetchResponse, retry bool, err error) {
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodGet, req.URL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if req.ETag != "" {
+		hreq.Header.Set("If-None-Match", req.ETag)
+	}
+	if req.LastModified != "" {
+		hreq.Header.Set("If-Modified-Since", req.LastModified)
+	}
+	hresp, err := client.Do(hreq)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	switch {
+	case hresp.StatusCode == http.StatusNotModified:
+		_ = hresp.Body.Close()
+		return &FetchResponse{NotModified: true, ETag: req.ETag, LastModified: req.LastModified}, false, nil
+	case hresp.StatusCode == http.StatusOK:
+		return &FetchResponse{
+			Body:         hresp.Body,
+			ETag:         hresp.Header.Get("ETag"),
+			LastModified: hresp.Header.Get("Last-Modified"),
+		}, false, nil
+	default:
+		_ = hresp.Body.Close()
+		retry = hresp.StatusCode >= 500 || hresp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("unexpected status %s", hresp.Status)
+	}
+}
+
+// isRemote Report whether the path is fetched by a Fetcher.
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// cacheEntry Define the validators of a cached remote file.
+type cacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	SHA256       string `json:"sha256"`
+}
+
+// fetchAll Download the remote data files of the option, see fetch. The
+// local copies are returned by URL, done releases all of them.
+func fetchAll(opt Option) (paths map[string]string, done func(), err error) {
+	paths = make(map[string]string)
+	var dones []func()
+	done = func() {
+		for _, d := range dones {
+			d()
+		}
+	}
+	for _, fn := range opt.Files {
+		if !isRemote(fn.Path) {
+			continue
+		}
+		path, d, err := fetch(opt, fn)
+		if err != nil {
+			done()
+			return nil, nil, fmt.Errorf("fetch %s error, %s", fn.Path, err)
+		}
+		paths[fn.Path] = path
+		dones = append(dones, d)
+	}
+	return paths, done, nil
+}
+
+// fetch Download the remote data file and return the path of the local
+// copy. With Option.CacheDir the copy is kept there and only downloaded
+// again when it changed or doesn't match its recorded checksum, otherwise
+// done removes the temporary copy.
+func fetch(opt Option, fn FileInfo) (path string, done func(), err error) {
+	fetcher := opt.Fetcher
+	if fetcher == nil {
+		fetcher = &HTTPFetcher{Retries: 2}
+	}
+	done = func() {}
+	req := &FetchRequest{URL: fn.Path}
+	var cached cacheEntry
+	dir := opt.CacheDir
+	if dir != "" {
+		key := sha256.Sum256([]byte(fn.Path))
+		path = filepath.Join(dir, hex.EncodeToString(key[:8])+".data")
+		if data, err := os.ReadFile(path + ".json"); err == nil && json.Unmarshal(data, &cached) == nil {
+			if _, err = os.Stat(path); err == nil && cached.URL == fn.Path {
+				req.ETag, req.LastModified = cached.ETag, cached.LastModified
+			}
+		}
+	} else {
+		dir = os.TempDir()
+	}
+
+	resp, err := fetcher.Fetch(context.Background(), req)
+	if err == nil && resp.NotModified && req.ETag+req.LastModified != "" {
+		if sum, err := fileSum(path); err == nil && strings.EqualFold(sum, cached.SHA256) {
+			return path, done, nil
+		}
+		// The cached copy was damaged, download it again
+		req.ETag, req.LastModified = "", ""
+		resp, err = fetcher.Fetch(context.Background(), req)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.NotModified {
+		return "", nil, fmt.Errorf("not modified response without cached copy")
+	}
+
+	f, err := os.CreateTemp(dir, "fetch.*.tmp")
+	if err != nil {
+		_ = resp.Body.Close()
+		return "", nil, err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	_ = resp.Body.Close()
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if err == nil && fn.Checksum != "" && !strings.EqualFold(sum, fn.Checksum) {
+		err = fmt.Errorf("checksum mismatch, got sha256 %s, want %s", sum, fn.Checksum)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", nil, err
+	}
+	if opt.CacheDir == "" {
+		return f.Name(), func() { _ = os.Remove(f.Name()) }, nil
+	}
+
+	if err = os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return "", nil, err
+	}
+	data, _ := json.Marshal(cacheEntry{URL: fn.Path, ETag: resp.ETag, LastModified: resp.LastModified, SHA256: sum})
+	if err = os.WriteFile(path+".json", data, 0o644); err != nil {
+		return "", nil, err
+	}
+	return path, done, nil
+}
+
+// fileSum Return the SHA-256 of the file in hex.
+func fileSum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,102 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	var data atomic.Value
+	data.Store("1.55.0.0\t1.55.255.255\t中国\t上海\n")
+	var requests, failures atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failures.Load() > 0 {
+			failures.Add(-1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body := data.Load().(string)
+		sum := sha256.Sum256([]byte(body))
+		etag := `"` + hex.EncodeToString(sum[:4]) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256([]byte(data.Load().(string)))
+	opt := Option{
+		Files:    []FileInfo{{Path: srv.URL + "/v4.txt", Type: IPV4, Checksum: hex.EncodeToString(sum[:])}},
+		Fetcher:  &HTTPFetcher{Retries: 2, Backoff: time.Millisecond},
+		CacheDir: t.TempDir(),
+		// rows hold only the leading columns
+		ParseMode: Lenient,
+	}
+	failures.Store(2)
+	st := NewStore()
+	if err := st.LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.Province != "上海" {
+		t.Errorf("unexpected result %v", m)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("got %d requests, want 2 retries", n)
+	}
+
+	// not modified, loaded from the cache
+	if err := st.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if st.Search(net.ParseIP("1.55.29.242")) == nil {
+		t.Error("cached copy not loaded")
+	}
+
+	// a damaged cached copy is downloaded again despite the validators
+	copies, _ := filepath.Glob(filepath.Join(opt.CacheDir, "*.data"))
+	if len(copies) != 1 {
+		t.Fatalf("unexpected cached copies %v", copies)
+	}
+	if err := os.WriteFile(copies[0], []byte("damaged\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n := requests.Load()
+	if err := st.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests.Load() - n; got != 2 || st.Search(net.ParseIP("1.55.29.242")) == nil {
+		t.Errorf("damaged copy not replaced, %d requests", got)
+	}
+
+	failures.Store(3)
+	if err := st.Update(); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected error after retries, got %v", err)
+	}
+
+	data.Store("1.55.0.0\t1.55.255.255\t中国\t北京\n")
+	if err := st.Update(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+	opt.Files[0].Checksum = ""
+	opt.CacheDir = ""
+	if err := st.LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.Province != "北京" {
+		t.Errorf("unexpected result %v", m)
+	}
+}
@@ -0,0 +1,137 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// History Index dated versions of a dataset to answer lookups as of a
+// point in time. Identical metas and ranges are shared between versions,
+// so that versions differing by a few ranges cost little memory.
+type History struct {
+	mu       sync.RWMutex
+	datasets []*datedStore // Sorted by date
+	metaList []*Meta       // Metas of every version
+	metas    map[string]uint32
+	v4       map[IPV4Entity]*IPV4Entity
+	v6       map[IPV6Entity]*IPV6Entity
+}
+
+// datedStore Define a version of the dataset and the time it applies from.
+type datedStore struct {
+	from  time.Time
+	store *Store
+}
+
+// NewHistory returns a new history.
+func NewHistory() *History {
+	return &History{
+		metas: make(map[string]uint32),
+		v4:    make(map[IPV4Entity]*IPV4Entity),
+		v6:    make(map[IPV6Entity]*IPV6Entity),
+	}
+}
+
+// Load Load a version of the dataset valid from the given time until the
+// next version.
+func (h *History) Load(from time.Time, opt Option) error {
+	st := NewStore()
+	opt.Overlays, opt.History = nil, 0
+	if err := st.LoadData(opt); err != nil {
+		return err
+	}
+	return h.Add(from, st)
+}
+
+// Add Add the current data of the store as the version valid from the
+// given time until the next version. Later changes of the store are not
+// seen by the history.
+func (h *History) Add(from time.Time, st *Store) error {
+	snap := st.snapshot()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := sort.Search(len(h.datasets), func(i int) bool { return !h.datasets[i].from.Before(from) })
+	if i < len(h.datasets) && h.datasets[i].from.Equal(from) {
+		return fmt.Errorf("a version already exists at %s", from)
+	}
+
+	v4List := make([]*IPV4Entity, len(snap.ipv4EntityList))
+	for j, e := range snap.ipv4EntityList {
+		key := IPV4Entity{startIndex: e.startIndex, endIndex: e.endIndex, metaIndex: h.meta(snap.v4MateList[e.metaIndex])}
+		if v4List[j] = h.v4[key]; v4List[j] == nil {
+			v4List[j] = &key
+			h.v4[key] = v4List[j]
+		}
+	}
+	v6List := make([]*IPV6Entity, len(snap.ipv6EntityList))
+	for j, e := range snap.ipv6EntityList {
+		key := IPV6Entity{startIndex: e.startIndex, endIndex: e.endIndex, metaIndex: h.meta(snap.v6MateList[e.metaIndex])}
+		if v6List[j] = h.v6[key]; v6List[j] == nil {
+			v6List[j] = &key
+			h.v6[key] = v6List[j]
+		}
+	}
+
+	// The meta list only grows, so the slice stays valid for this version
+	dated := &datedStore{from: from, store: (&snapshot{
+		ipv4EntityList: v4List,
+		ipv6EntityList: v6List,
+		v4MateList:     h.metaList,
+		v6MateList:     h.metaList,
+		info:           snap.info,
+	}).store()}
+	h.datasets = append(h.datasets, nil)
+	copy(h.datasets[i+1:], h.datasets[i:])
+	h.datasets[i] = dated
+	return nil
+}
+
+// meta Return the index of the meta in the shared meta list.
+func (h *History) meta(m *Meta) uint32 {
+	fp := m.Hash()
+	if index, ok := h.metas[fp]; ok {
+		return index
+	}
+	index := uint32(len(h.metaList))
+	h.metaList = append(h.metaList, m)
+	h.metas[fp] = index
+	return index
+}
+
+// Dates Return the dates the versions apply from, in order.
+func (h *History) Dates() []time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	dates := make([]time.Time, len(h.datasets))
+	for i, d := range h.datasets {
+		dates[i] = d.from
+	}
+	return dates
+}
+
+// At Return the read only store of the version valid at the given time,
+// nil if it is before the first version.
+func (h *History) At(at time.Time) *Store {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	i := sort.Search(len(h.datasets), func(i int) bool { return h.datasets[i].from.After(at) })
+	if i == 0 {
+		return nil
+	}
+	return h.datasets[i-1].store
+}
+
+// SearchAt Return the location of the address in the version valid at the
+// given time.
+func (h *History) SearchAt(addr net.IP, at time.Time) *Meta {
+	st := h.At(at)
+	if st == nil {
+		return nil
+	}
+	return st.Search(addr)
+}
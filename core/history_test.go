@@ -0,0 +1,62 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := jan.AddDate(0, 1, 0)
+
+	b := NewBuilder()
+	_ = b.AddPrefix(netip.MustParsePrefix("10.0.0.0/24"), &Meta{Country: "中国"})
+	_ = b.AddPrefix(netip.MustParsePrefix("10.0.1.0/24"), &Meta{Country: "日本"})
+	old, _ := b.Build()
+	b = NewBuilder()
+	_ = b.AddPrefix(netip.MustParsePrefix("10.0.0.0/24"), &Meta{Country: "中国"})
+	_ = b.AddPrefix(netip.MustParsePrefix("10.0.1.0/24"), &Meta{Country: "美国"})
+	cur, _ := b.Build()
+
+	h := NewHistory()
+	// versions may be added in any order
+	if err := h.Add(feb, cur); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Add(jan, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Add(jan, cur); err == nil {
+		t.Error("expected error for duplicate date")
+	}
+
+	for _, c := range []struct {
+		addr string
+		at   time.Time
+		want string
+	}{
+		{"10.0.1.1", jan.Add(-time.Second), ""},
+		{"10.0.1.1", jan, "日本"},
+		{"10.0.1.1", feb.Add(-time.Second), "日本"},
+		{"10.0.1.1", feb, "美国"},
+		{"10.0.0.1", feb.AddDate(1, 0, 0), "中国"},
+	} {
+		got := ""
+		if m := h.SearchAt(net.ParseIP(c.addr), c.at); m != nil {
+			got = m.Country
+		}
+		if got != c.want {
+			t.Errorf("SearchAt(%s, %s) = %q, want %q", c.addr, c.at, got, c.want)
+		}
+	}
+
+	if len(h.metaList) != 3 || len(h.v4) != 3 {
+		t.Errorf("got %d metas and %d ranges, want 3 shared", len(h.metaList), len(h.v4))
+	}
+	if h.At(jan).IPV4Entity(0) != h.At(feb).IPV4Entity(0) {
+		t.Error("identical ranges must be shared between versions")
+	}
+}
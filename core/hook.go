@@ -0,0 +1,181 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"sort"
+	"time"
+)
+
+// ReloadEvent Describe the publication of a new version of the data, by a
+// load, an applied patch or a rollback, or a change of the published one,
+// by Set, Delete or the load of an overlay.
+type ReloadEvent struct {
+	OldVersion uint64        // Version published before, 0 if none
+	NewVersion uint64        // Version published by the reload, OldVersion when changed in place
+	Overlay    string        // Name of the loaded overlay, empty for the base data
+	Report     LoadReport    // Report of the load of the new version or of the overlay
+	Duration   time.Duration // Time taken to load the version
+	Changes    ChangeSummary // Ranges changed between both versions, or both loads of the overlay
+}
+
+// ChangeSummary Summarize the differences of two versions by comparing
+// their ranges, see Diff for a detailed comparison.
+type ChangeSummary struct {
+	Added     int      // Ranges only in the new version
+	Removed   int      // Ranges only in the old version
+	Countries []string // Sorted countries of the added and removed ranges
+}
+
+// reloadHook Define a subscription to reload events.
+type reloadHook struct {
+	fn func(ReloadEvent)
+}
+
+// OnReload Subscribe fn to the reload events of the store and return the
+// function cancelling the subscription. Events are delivered in order,
+// after the new version is published, and fn may use the store.
+func (s *Store) OnReload(fn func(ReloadEvent)) (cancel func()) {
+	hook := &reloadHook{fn: fn}
+	s.mu.Lock()
+	s.hooks = append(s.hooks[:len(s.hooks):len(s.hooks)], hook)
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		hooks := make([]*reloadHook, 0, len(s.hooks))
+		for _, h := range s.hooks {
+			if h != hook {
+				hooks = append(hooks, h)
+			}
+		}
+		s.hooks = hooks
+	}
+}
+
+// queueEvent Queue the event of the change from the old snapshot to cur,
+// when there are subscribers. The caller holds editMu and has not
+// published cur yet.
+func (s *Store) queueEvent(old, cur *snapshot, ev ReloadEvent) {
+	s.mu.RLock()
+	subscribed := len(s.hooks) > 0
+	s.mu.RUnlock()
+	if !subscribed {
+		return
+	}
+	ev.Changes = summarize(old, cur)
+	s.mu.Lock()
+	s.events = append(s.events, ev)
+	s.mu.Unlock()
+}
+
+// deliverEvents Pass the queued events to the subscribers. It is deferred
+// by the callers of commit before taking editMu, so that subscribers run
+// without it. When events are already being delivered, by an outer call
+// or another goroutine, the queued events are left to that delivery.
+func (s *Store) deliverEvents() {
+	for {
+		s.mu.Lock()
+		if s.delivering || len(s.events) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		s.delivering = true
+		events, hooks := s.events, s.hooks
+		s.events = nil
+		s.mu.Unlock()
+
+		s.deliver(events, hooks)
+	}
+}
+
+// deliver Pass the events to the hooks and end the delivery, even if a
+// hook panics.
+func (s *Store) deliver(events []ReloadEvent, hooks []*reloadHook) {
+	defer func() {
+		s.mu.Lock()
+		s.delivering = false
+		s.mu.Unlock()
+	}()
+	for _, ev := range events {
+		for _, h := range hooks {
+			h.fn(ev)
+		}
+	}
+}
+
+// summarize Compare the ranges of both snapshots, ranges are equal when
+// their bounds and metas are.
+func summarize(old, cur *snapshot) ChangeSummary {
+	var sum ChangeSummary
+	countries := make(map[string]bool)
+	count := func(m *Meta, added bool) {
+		if added {
+			sum.Added++
+		} else {
+			sum.Removed++
+		}
+		countries[m.Country] = true
+	}
+	compareRanges[uint32](old.ipv4EntityList, cur.ipv4EntityList, old.v4MateList, cur.v4MateList, count)
+	compareRanges[uint64](old.ipv6EntityList, cur.ipv6EntityList, old.v6MateList, cur.v6MateList, count)
+
+	for c := range countries {
+		sum.Countries = append(sum.Countries, c)
+	}
+	sort.Strings(sum.Countries)
+	return sum
+}
+
+// rangeEntity Define the ranges of both families for compareRanges.
+type rangeEntity[T uint32 | uint64] interface {
+	StartIndex() T
+	EndIndex() T
+	meta() uint32
+}
+
+// compareRanges Walk the sorted ranges of both lists and count the ranges
+// only in one of them. Ranges with the same bounds are compared by meta,
+// the hashes of the metas are only computed when they are not the same.
+func compareRanges[T uint32 | uint64, E rangeEntity[T]](old, cur []E, oldMetas, curMetas []*Meta, count func(m *Meta, added bool)) {
+	oldHashes, curHashes := newMetaHasher(oldMetas), newMetaHasher(curMetas)
+	i, j := 0, 0
+	for i < len(old) || j < len(cur) {
+		switch {
+		case j == len(cur) || (i < len(old) && (old[i].StartIndex() < cur[j].StartIndex() ||
+			(old[i].StartIndex() == cur[j].StartIndex() && old[i].EndIndex() < cur[j].EndIndex()))):
+			count(oldMetas[old[i].meta()], false)
+			i++
+		case i == len(old) || old[i].StartIndex() != cur[j].StartIndex() || old[i].EndIndex() != cur[j].EndIndex():
+			count(curMetas[cur[j].meta()], true)
+			j++
+		default:
+			om, cm := old[i].meta(), cur[j].meta()
+			if oldMetas[om] != curMetas[cm] && oldHashes.hash(om) != curHashes.hash(cm) {
+				count(oldMetas[om], false)
+				count(curMetas[cm], true)
+			}
+			i, j = i+1, j+1
+		}
+	}
+}
+
+// metaHasher Compute the hashes of metas once per meta rather than once
+// per range, and only when needed.
+type metaHasher struct {
+	metas  []*Meta
+	hashes []string
+}
+
+func newMetaHasher(metas []*Meta) *metaHasher {
+	return &metaHasher{metas: metas}
+}
+
+func (h *metaHasher) hash(i uint32) string {
+	if h.hashes == nil {
+		h.hashes = make([]string, len(h.metas))
+	}
+	if h.hashes[i] == "" {
+		h.hashes[i] = h.metas[i].Hash()
+	}
+	return h.hashes[i]
+}
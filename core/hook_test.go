@@ -0,0 +1,86 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestOnReload(t *testing.T) {
+	path := t.TempDir() + "/v4.txt"
+	writeFile(t, path, "1.55.0.0\t1.55.0.255\t中国\n1.55.1.0\t1.55.1.255\t日本\n")
+
+	st := NewStore()
+	var events []ReloadEvent
+	cancel := st.OnReload(func(ev ReloadEvent) {
+		events = append(events, ev)
+		// subscribers may use the store
+		if ev.NewVersion == 2 {
+			if err := st.Rollback(1); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	if err := st.LoadData(Option{Files: []FileInfo{{Path: path, Type: IPV4}}, History: 1, ParseMode: Lenient}); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "1.55.0.0\t1.55.0.255\t中国\n1.55.1.0\t1.55.1.255\t美国\n1.55.2.0\t1.55.2.255\t美国\n")
+	if err := st.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	if ev := events[0]; ev.OldVersion != 0 || ev.NewVersion != 1 || ev.Changes.Added != 2 || len(ev.Report.Files) != 1 {
+		t.Errorf("unexpected load event %+v", ev)
+	}
+	if c := events[1].Changes; c.Added != 2 || c.Removed != 1 || strings.Join(c.Countries, ",") != "日本,美国" {
+		t.Errorf("unexpected update changes %+v", c)
+	}
+	if ev := events[2]; ev.OldVersion != 2 || ev.NewVersion != 1 || ev.Changes.Removed != 2 {
+		t.Errorf("unexpected rollback event %+v", ev)
+	}
+
+	// edits and overlays change the published version in place
+	events = nil
+	if err := st.Set(netip.MustParsePrefix("1.55.3.0/24"), &Meta{Country: "法国"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Delete(netip.MustParsePrefix("1.55.0.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	overlay := t.TempDir() + "/office.txt"
+	writeFile(t, overlay, "1.55.9.0\t1.55.9.255\t德国\n")
+	if err := st.LoadData(Option{Files: []FileInfo{{Path: path, Type: IPV4}}, ParseMode: Lenient,
+		Overlays: []Overlay{{Name: "office", Files: []FileInfo{{Path: overlay, Type: IPV4}}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ReloadOverlay("office"); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("got %d events, want 5", len(events))
+	}
+	if ev := events[0]; ev.OldVersion != 1 || ev.NewVersion != 1 || ev.Changes.Added != 1 || strings.Join(ev.Changes.Countries, ",") != "法国" {
+		t.Errorf("unexpected set event %+v", ev)
+	}
+	if ev := events[1]; ev.NewVersion != 1 || ev.Changes.Removed != 1 || ev.Changes.Added != 0 {
+		t.Errorf("unexpected delete event %+v", ev)
+	}
+	if ev := events[3]; ev.Overlay != "office" || ev.OldVersion != 3 || ev.NewVersion != 3 || ev.Changes.Added != 1 {
+		t.Errorf("unexpected overlay load event %+v", ev)
+	}
+	if ev := events[4]; ev.Overlay != "office" || ev.Changes.Added != 0 || ev.Changes.Removed != 0 {
+		t.Errorf("unexpected overlay reload event %+v", ev)
+	}
+
+	cancel()
+	if err := st.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 5 {
+		t.Error("event delivered after cancel")
+	}
+}
@@ -0,0 +1,187 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Info Define the metadata of a dataset. Data files declare it in leading
+// comment lines of the form "#@key: value", or in a JSON sidecar file
+// named after a local data file with the .info.json suffix, which takes
+// precedence but is not signed, so it is ignored with Option.TrustedKeys.
+// Malformed lines fail the file unless Option.ParseMode is Lenient, which
+// reports them with the row errors:
+//
+//	#@version: 2024.05.01
+//	#@build_time: 2024-05-01T00:00:00Z
+//	#@vendor: ipip.net
+//	#@license: commercial
+//	#@ipv4_count: 4096
+type Info struct {
+	Version   string    `json:"version,omitempty"`
+	BuildTime time.Time `json:"build_time"`
+	Vendor    string    `json:"vendor,omitempty"`
+	License   string    `json:"license,omitempty"`
+	IPV4Count int       `json:"ipv4_count,omitempty"` // Number of IPv4 ranges
+	IPV6Count int       `json:"ipv6_count,omitempty"` // Number of IPv6 ranges
+}
+
+// MarshalJSON Implement json.Marshaler, build_time is left out when not
+// set like the other fields.
+func (i Info) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Version   string     `json:"version,omitempty"`
+		BuildTime *time.Time `json:"build_time,omitempty"`
+		Vendor    string     `json:"vendor,omitempty"`
+		License   string     `json:"license,omitempty"`
+		IPV4Count int        `json:"ipv4_count,omitempty"`
+		IPV6Count int        `json:"ipv6_count,omitempty"`
+	}{Version: i.Version, Vendor: i.Vendor, License: i.License, IPV4Count: i.IPV4Count, IPV6Count: i.IPV6Count}
+	if !i.BuildTime.IsZero() {
+		v.BuildTime = &i.BuildTime
+	}
+	return json.Marshal(v)
+}
+
+// infoPrefix Prefix of the comment lines declaring the metadata.
+const infoPrefix = "#@"
+
+// infoSuffix Suffix of the sidecar metadata file of a data file.
+const infoSuffix = ".info.json"
+
+// Info Return the metadata of the published data, the counts are those of
+// the loaded ranges of the same version.
+func (s *Store) Info() Info {
+	snap := s.snapshot()
+	info := snap.info
+	info.IPV4Count, info.IPV6Count = len(snap.ipv4EntityList), len(snap.ipv6EntityList)
+	return info
+}
+
+// IsZero Report whether no metadata is declared.
+func (i Info) IsZero() bool {
+	return i == Info{}
+}
+
+// declared Report whether metadata other than the counts is set.
+func (i Info) declared() bool {
+	return i.Version != "" || !i.BuildTime.IsZero() || i.Vendor != "" || i.License != ""
+}
+
+// merge Return the metadata completed by the fields of o that i lacks, the
+// counts are added.
+func (i Info) merge(o Info) Info {
+	if i.Version == "" {
+		i.Version = o.Version
+	}
+	if i.BuildTime.IsZero() {
+		i.BuildTime = o.BuildTime
+	}
+	if i.Vendor == "" {
+		i.Vendor = o.Vendor
+	}
+	if i.License == "" {
+		i.License = o.License
+	}
+	i.IPV4Count += o.IPV4Count
+	i.IPV6Count += o.IPV6Count
+	return i
+}
+
+// parseInfo Return the metadata declared by the leading comment lines of
+// the head of a data file, and the errors of the lines it could not use.
+func parseInfo(head []byte) (Info, []RowError) {
+	var info Info
+	var errs []RowError
+	head = bytes.TrimPrefix(head, []byte(utf8BOM))
+	for i, line := range strings.Split(string(head), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, infoPrefix), ":")
+		if !strings.HasPrefix(line, infoPrefix) || !ok {
+			continue
+		}
+		if err := info.set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			errs = append(errs, RowError{Line: i + 1, Err: err})
+		}
+	}
+	return info, errs
+}
+
+// set Set the metadata field of the key, unknown keys are ignored.
+func (i *Info) set(key, value string) error {
+	var err error
+	switch key {
+	case "version":
+		i.Version = value
+	case "build_time":
+		i.BuildTime, err = time.Parse(time.RFC3339, value)
+	case "vendor":
+		i.Vendor = value
+	case "license":
+		i.License = value
+	case "ipv4_count":
+		i.IPV4Count, err = strconv.Atoi(value)
+	case "ipv6_count":
+		i.IPV6Count, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		return fmt.Errorf("bad metadata %s %q", key, value)
+	}
+	return nil
+}
+
+// writeInfo Write the metadata as comment lines, skipping empty fields.
+func writeInfo(w io.Writer, i Info) error {
+	var b strings.Builder
+	line := func(key, value string) {
+		if value != "" {
+			b.WriteString(infoPrefix + key + ": " + value + "\n")
+		}
+	}
+	line("version", i.Version)
+	if !i.BuildTime.IsZero() {
+		line("build_time", i.BuildTime.Format(time.RFC3339))
+	}
+	line("vendor", i.Vendor)
+	line("license", i.License)
+	if i.IPV4Count > 0 {
+		line("ipv4_count", strconv.Itoa(i.IPV4Count))
+	}
+	if i.IPV6Count > 0 {
+		line("ipv6_count", strconv.Itoa(i.IPV6Count))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// readSidecar Return the metadata of the sidecar file of a local data
+// file, and whether it exists.
+func readSidecar(path string) (Info, bool, error) {
+	var info Info
+	if isRemote(path) {
+		return info, false, nil
+	}
+	data, err := os.ReadFile(path + infoSuffix)
+	if os.IsNotExist(err) {
+		return info, false, nil
+	} else if err != nil {
+		return info, false, err
+	}
+	if err = json.Unmarshal(data, &info); err != nil {
+		return info, false, fmt.Errorf("bad metadata file %s, %s", path+infoSuffix, err)
+	}
+	return info, true, nil
+}
@@ -0,0 +1,133 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfo(t *testing.T) {
+	dir := t.TempDir()
+	v4 := "#@version: 2024.05.01\n#@build_time: 2024-05-01T08:00:00Z\n#@vendor: ipip.net\n#@ipv4_count: 2\n" +
+		"# other comment\n" +
+		"10.0.0.0\t10.0.1.255\t中国\n10.0.2.0\t10.0.2.255\t日本\n"
+	writeFile(t, dir+"/v4.txt", v4)
+	writeFile(t, dir+"/v6.txt", "2001:db8::/32\t中国\n")
+	writeFile(t, dir+"/v6.txt.info.json", `{"license":"commercial","ipv6_count":1}`)
+
+	st := NewStore()
+	if err := st.LoadData(Option{
+		Files:     []FileInfo{{Path: dir + "/v4.txt", Type: IPV4}, {Path: dir + "/v6.txt", Type: IPV6}},
+		ParseMode: Lenient,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := Info{
+		Version:   "2024.05.01",
+		BuildTime: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+		Vendor:    "ipip.net",
+		License:   "commercial",
+		IPV4Count: 2,
+		IPV6Count: 1,
+	}
+	if info := st.Info(); !reflect.DeepEqual(info, want) {
+		t.Errorf("got info %+v, want %+v", info, want)
+	}
+	if fr := st.Report().Files[1]; fr.Info.License != "commercial" || fr.Info.IPV6Count != 1 {
+		t.Errorf("unexpected sidecar info %+v", fr.Info)
+	}
+
+	// written by the exporters and read back
+	var buf bytes.Buffer
+	_ = st.WriteText(&buf, IPV4)
+	if !strings.HasPrefix(buf.String(), "#@version: 2024.05.01\n#@build_time: 2024-05-01T08:00:00Z\n#@vendor: ipip.net\n#@license: commercial\n#@ipv4_count: 2\n10.0.0.0") {
+		t.Errorf("unexpected text\n%s", buf.String())
+	}
+	copied := NewStore()
+	copied.opt.ParseMode = Lenient
+	if err := copied.UnmarshalFrom(&buf, IPV4); err != nil {
+		t.Fatal(err)
+	}
+	if info := copied.Info(); info.Vendor != "ipip.net" || info.IPV4Count != 2 {
+		t.Errorf("unexpected info after round trip %+v", info)
+	}
+
+	buf.Reset()
+	if err := st.Export(&buf, ExportOption{Format: ExportTSV, Columns: []string{ColCountry}, Countries: []string{"中国"}, Info: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "#@license: commercial\n#@ipv4_count: 1\n#@ipv6_count: 1\nstart_ip\tend_ip\tcountry\n") {
+		t.Errorf("unexpected export\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := st.Export(&buf, ExportOption{Format: ExportJSON, Info: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), `{"info":{"version":"2024.05.01","build_time":"2024-05-01T08:00:00Z","vendor":"ipip.net","license":"commercial","ipv4_count":2,"ipv6_count":1}}`) {
+		t.Errorf("unexpected export\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := st.Export(&buf, ExportOption{Format: ExportCSV}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), infoPrefix) {
+		t.Errorf("unexpected metadata in export\n%s", buf.String())
+	}
+	if data, _ := json.Marshal(Info{Vendor: "ipip.net"}); string(data) != `{"vendor":"ipip.net"}` {
+		t.Errorf("unexpected info JSON %s", data)
+	}
+
+	// carried by Merge and Builder
+	merged, _, err := Merge(MergeOption{Sources: []MergeSource{{Name: "other", Store: NewStore()}, {Name: "ipip", Store: st}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := merged.Info(); info.Vendor != "ipip.net" || info.License != "commercial" || info.IPV4Count != 2 {
+		t.Errorf("unexpected merged info %+v", info)
+	}
+}
+
+func TestInfoMalformed(t *testing.T) {
+	path := t.TempDir() + "/v4.txt"
+	data := "#@vendor: ipip.net\n#@build_time: yesterday\n10.0.0.0\t10.0.1.255\t中国" + strings.Repeat("\t*", 13) + "\n"
+	writeFile(t, path, data)
+	opt := Option{Files: []FileInfo{{Path: path, Type: IPV4}}}
+	if err := NewStore().LoadData(opt); err == nil || !strings.Contains(err.Error(), "line 2: bad metadata build_time") {
+		t.Errorf("expected metadata error, got %v", err)
+	}
+
+	opt.ParseMode = Lenient
+	st := NewStore()
+	if err := st.LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+	fr := st.Report().Files[0]
+	if len(fr.Errors) != 1 || fr.Errors[0].Line != 2 || fr.Info.Vendor != "ipip.net" || st.IPV4EntityCount() != 1 {
+		t.Errorf("unexpected report %+v", fr)
+	}
+}
+
+func TestInfoWhileEditing(t *testing.T) {
+	st := NewStore()
+	if err := st.LoadData(Option{Files: []FileInfo{{Path: "testdata/v4.txt", Type: IPV4}}}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			_ = st.Set(netip.PrefixFrom(netip.AddrFrom4([4]byte{10, 9, byte(i), 0}), 24), &Meta{Country: "中国"})
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if info := st.Info(); info.IPV4Count == 0 {
+			t.Fatal("no ranges counted")
+		}
+	}
+	<-done
+}
@@ -0,0 +1,199 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// MergeSource Define a vendor dataset taking part in a merge, either an
+// already loaded store or data files to load.
+type MergeSource struct {
+	Name  string
+	Store *Store
+	Files []FileInfo
+}
+
+// MergeOption Define the sources of a merge and how fields are resolved.
+type MergeOption struct {
+	Sources []MergeSource
+	// Precedence lists, per column name, the sources to take the field from
+	// in order of preference, e.g. city from one vendor and asn from another.
+	Precedence map[string][]string
+	// Default is the preference of the columns missing from Precedence,
+	// the order of Sources by default. Both only name sources of the merge.
+	Default []string
+}
+
+// Conflict Define a range where the sources disagree on the country.
+type Conflict struct {
+	Start     net.IP
+	End       net.IP
+	Countries map[string]string // Country by source name
+}
+
+// MergeReport Define the result of a merge.
+type MergeReport struct {
+	IPV4Count int // Number of IPv4 ranges of the merged store
+	IPV6Count int // Number of IPv6 ranges of the merged store
+	Conflicts []Conflict
+}
+
+// Merge Combine several datasets into one store. Ranges are split at the
+// boundaries of every source, and each field of a split range is taken
+// from the first source by precedence that has a value for it. Each field
+// of the metadata is taken from the first source in the Default order
+// that declares it.
+func Merge(opt MergeOption) (*Store, *MergeReport, error) {
+	if len(opt.Sources) == 0 {
+		return nil, nil, errors.New("no merge source")
+	}
+	names := make(map[string]bool)
+	for _, src := range opt.Sources {
+		if names[src.Name] {
+			return nil, nil, fmt.Errorf("duplicate merge source %q", src.Name)
+		}
+		names[src.Name] = true
+	}
+	for _, name := range opt.Default {
+		if !names[name] {
+			return nil, nil, fmt.Errorf("unknown merge source %q", name)
+		}
+	}
+	for column, prefs := range opt.Precedence {
+		for _, name := range prefs {
+			if !names[name] {
+				return nil, nil, fmt.Errorf("unknown merge source %q for %s", name, column)
+			}
+		}
+	}
+	stores := make([]*Store, len(opt.Sources))
+	for i, src := range opt.Sources {
+		if stores[i] = src.Store; stores[i] == nil {
+			stores[i] = NewStore()
+			if err := stores[i].LoadData(Option{Files: src.Files}); err != nil {
+				return nil, nil, fmt.Errorf("load merge source %q error, %s", src.Name, err)
+			}
+		}
+	}
+	m := &merger{opt: opt, names: names, b: NewBuilder(), report: &MergeReport{}}
+	var info Info
+	for _, i := range m.order("") {
+		info = info.merge(stores[i].Info())
+	}
+	m.b.SetInfo(info)
+	for _, family := range []string{IPV4, IPV6} {
+		if err := m.mergeFamily(family, stores); err != nil {
+			return nil, nil, err
+		}
+	}
+	st, err := m.b.Build()
+	if err != nil {
+		return nil, nil, err
+	}
+	m.report.IPV4Count, m.report.IPV6Count = st.IPV4EntityCount(), st.IPV6EntityCount()
+	return st, m.report, nil
+}
+
+type merger struct {
+	opt    MergeOption
+	names  map[string]bool
+	b      *Builder
+	report *MergeReport
+}
+
+// order Return the source indexes in order of preference for the column.
+func (m *merger) order(column string) []int {
+	prefs, ok := m.opt.Precedence[column]
+	if !ok {
+		prefs = m.opt.Default
+	}
+	var order []int
+	used := make([]bool, len(m.opt.Sources))
+	for _, name := range prefs {
+		for i, src := range m.opt.Sources {
+			if src.Name == name && !used[i] {
+				used[i] = true
+				order = append(order, i)
+			}
+		}
+	}
+	for i := range m.opt.Sources {
+		if !used[i] {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+func (m *merger) mergeFamily(family string, stores []*Store) error {
+	var pending *span
+	err := segments(family, stores, func(start, end uint64, covering []*Meta) error {
+		meta := m.resolve(covering)
+		m.checkConflict(family, start, end, covering)
+		// Coalesce adjacent segments resolving to the same meta.
+		if pending != nil && pending.end+1 == start && pending.meta.Hash() == meta.Hash() {
+			pending.end = end
+			return nil
+		}
+		if err := m.add(family, pending); err != nil {
+			return err
+		}
+		pending = &span{start: start, end: end, meta: meta}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return m.add(family, pending)
+}
+
+func (m *merger) add(family string, sp *span) error {
+	if sp == nil {
+		return nil
+	}
+	start, end := indexAddr(family, sp.start, false), indexAddr(family, sp.end, true)
+	return m.b.AddRange(start, end, sp.meta)
+}
+
+// resolve Build the meta of a segment from the metas of the sources
+// covering it, nil for sources not covering it.
+func (m *merger) resolve(covering []*Meta) *Meta {
+	r := &RowMeta{}
+	attrs := make(Attrs)
+	for _, meta := range covering {
+		if meta != nil {
+			for k := range meta.Attrs {
+				attrs[k] = ""
+			}
+		}
+	}
+	for _, column := range append(append([]string{}, metaColumns...), attrs.keys()...) {
+		for _, i := range m.order(column) {
+			if v := covering[i].Column(column); v != "" {
+				_ = r.setColumn(column, v)
+				break
+			}
+		}
+	}
+	return r.Meta()
+}
+
+func (m *merger) checkConflict(family string, start, end uint64, covering []*Meta) {
+	countries := make(map[string]string)
+	distinct := make(map[string]bool)
+	for i, meta := range covering {
+		if meta != nil && meta.Country != "" {
+			countries[m.opt.Sources[i].Name] = meta.Country
+			distinct[meta.Country] = true
+		}
+	}
+	if len(distinct) > 1 {
+		m.report.Conflicts = append(m.report.Conflicts, Conflict{
+			Start:     indexIP(family, start, false),
+			End:       indexIP(family, end, true),
+			Countries: countries,
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	geo := NewBuilder()
+	_ = geo.AddPrefix(netip.MustParsePrefix("10.0.0.0/23"), &Meta{Country: "中国", City: "上海", IspDomain: "geo-isp"})
+	_ = geo.AddPrefix(netip.MustParsePrefix("10.0.2.0/24"), &Meta{Country: "中国", City: "北京"})
+	_ = geo.AddPrefix(netip.MustParsePrefix("2001:db8::/32"), &Meta{Country: "中国", City: "广州"})
+	geoStore, _ := geo.Build()
+
+	isp := NewBuilder()
+	_ = isp.AddPrefix(netip.MustParsePrefix("10.0.1.0/24"), &Meta{Country: "日本", IspDomain: "ntt.co.jp", Asn: []int64{2914}})
+	_ = isp.AddPrefix(netip.MustParsePrefix("10.0.2.0/23"), &Meta{Country: "中国", IspDomain: "chinanet", Asn: []int64{4134}})
+	ispStore, _ := isp.Build()
+
+	st, report, err := Merge(MergeOption{
+		Sources: []MergeSource{{Name: "geo", Store: geoStore}, {Name: "isp", Store: ispStore}},
+		Precedence: map[string][]string{
+			ColIspDomain: {"isp", "geo"},
+			ColAsn:       {"isp"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	st.Walk(IPV4, func(start, end net.IP, m *Meta) bool {
+		got = append(got, start.String()+"-"+end.String()+" "+m.Country+" "+m.City+" "+m.IspDomain+" "+m.Column(ColAsn))
+		return true
+	})
+	want := []string{
+		"10.0.0.0-10.0.0.255 中国 上海 geo-isp ",
+		"10.0.1.0-10.0.1.255 中国 上海 ntt.co.jp 2914",
+		"10.0.2.0-10.0.2.255 中国 北京 chinanet 4134",
+		"10.0.3.0-10.0.3.255 中国  chinanet 4134",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got ranges\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if m := st.Search(net.ParseIP("2001:db8::1")); m == nil || m.City != "广州" {
+		t.Errorf("unexpected v6 result %v", m)
+	}
+
+	if report.IPV4Count != 4 || report.IPV6Count != 1 || len(report.Conflicts) != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	c := report.Conflicts[0]
+	if c.Start.String() != "10.0.1.0" || c.End.String() != "10.0.1.255" || c.Countries["geo"] != "中国" || c.Countries["isp"] != "日本" {
+		t.Errorf("unexpected conflict %+v", c)
+	}
+
+	if _, _, err = Merge(MergeOption{Sources: []MergeSource{{Name: "a", Store: geoStore}, {Name: "a", Store: ispStore}}}); err == nil {
+		t.Error("expected duplicate source error")
+	}
+	sources := []MergeSource{{Name: "geo", Store: geoStore}, {Name: "isp", Store: ispStore}}
+	if _, _, err = Merge(MergeOption{Sources: sources, Precedence: map[string][]string{ColCity: {"ips"}}}); err == nil {
+		t.Error("expected unknown precedence source error")
+	}
+	if _, _, err = Merge(MergeOption{Sources: sources, Default: []string{"isp", "Geo"}}); err == nil {
+		t.Error("expected unknown default source error")
+	}
+}
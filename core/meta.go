@@ -7,15 +7,17 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 
 	"github.com/universal-fraternity/ipip/utils"
 )
 
+// Format names of the built-in data files, used as FileInfo.Type.
 const (
-	Unknown = iota
-	IPV4
-	IPV6
+	Unknown = ""
+	IPV4    = "ipv4"
+	IPV6    = "ipv6"
 )
 
 // RowMeta define row metadata
@@ -38,6 +40,7 @@ type RowMeta struct {
 	Line           string      // national line
 	Comment        *string     // Other remarks information
 	Type           *string     // Network type
+	Attrs          Attrs       // Custom attributes from extra columns
 	Extends        interface{} // Extended Information
 	startIPObj     net.IP      // IP starting position
 	endIPObj       net.IP      // IP end position
@@ -61,19 +64,71 @@ type Meta struct {
 	Line           string      // national line
 	Comment        *string     // Other remarks information
 	Type           *string     // Network type
+	Attrs          Attrs       // Custom attributes from extra columns
+	Source         string      // Name of the overlay providing the meta, empty for the base data
+	Stale          bool        // Whether the meta comes from the last-known-good cache, see Store.Stale
 	Extends        interface{} // Extended Information
 }
 
+// Attrs Custom attributes keyed by column name.
+type Attrs map[string]string
+
+// String Format output, keys are sorted.
+func (a Attrs) String() string {
+	var b strings.Builder
+	for i, k := range a.keys() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(a[k])
+	}
+	return b.String()
+}
+
 // NewMeta Return a new meta
 func NewMeta() *Meta {
 	return &Meta{}
 }
 
+// Attr Return the custom attribute of the column name.
+func (m *Meta) Attr(name string) string {
+	if m == nil {
+		return ""
+	}
+	return m.Attrs[name]
+}
+
 // WithExtends Set extension information
 func (m *Meta) WithExtends(en interface{}) {
 	m.Extends = en
 }
 
+// clone Return a copy of the meta sharing no slice, pointer or map with it,
+// Extends is copied as is.
+func (m *Meta) clone() *Meta {
+	c := *m
+	if m.Asn != nil {
+		c.Asn = append([]int64{}, m.Asn...)
+	}
+	if m.Comment != nil {
+		comment := *m.Comment
+		c.Comment = &comment
+	}
+	if m.Type != nil {
+		typ := *m.Type
+		c.Type = &typ
+	}
+	if m.Attrs != nil {
+		c.Attrs = make(Attrs, len(m.Attrs))
+		for k, v := range m.Attrs {
+			c.Attrs[k] = v
+		}
+	}
+	return &c
+}
+
 // IsEmpty If all fields are empty, return true.
 func (m Meta) IsEmpty() bool {
 	return m.Country == "" &&
@@ -86,7 +141,10 @@ func (m Meta) IsEmpty() bool {
 		m.Longitude == 0 &&
 		m.Timezone == "" &&
 		m.CountryCode == "" &&
-		len(m.Asn) == 0
+		len(m.Asn) == 0 &&
+		m.Comment == nil &&
+		m.Type == nil &&
+		len(m.Attrs) == 0
 }
 
 // IsEmpty If all fields are empty, return true.
@@ -103,11 +161,14 @@ func (r *RowMeta) IsEmpty() bool {
 		r.Longitude == 0 &&
 		r.Timezone == "" &&
 		r.CountryCode == "" &&
-		len(r.Asn) == 0
+		len(r.Asn) == 0 &&
+		r.Comment == nil &&
+		r.Type == nil &&
+		len(r.Attrs) == 0
 }
 
 // Unmarshal Parse detailed information into meta format.
-func (r *RowMeta) Unmarshal(buffer []byte, t int) error {
+func (r *RowMeta) Unmarshal(buffer []byte, t string) error {
 	if t == IPV6 {
 		return r.UnmarshalV6(buffer)
 	} else if t == IPV4 {
@@ -118,122 +179,182 @@ func (r *RowMeta) Unmarshal(buffer []byte, t int) error {
 
 // UnmarshalV4 Parse detailed information into meta format.
 func (r *RowMeta) UnmarshalV4(row string) error {
-	var e error
-	if r != nil {
-		for i, item := range strings.Split(strings.TrimSuffix(row, "\n"), "\t") {
-			switch i {
-			case 0:
-				r.StartIP = item
-				r.startIPObj = net.ParseIP(item)
-			case 1:
-				r.EndIP = item
-				r.endIPObj = net.ParseIP(item)
-			case 2:
-				r.Country = item
-			case 3:
-				r.Province = utils.RefineOutput(item)
-			case 4:
-				r.City = utils.RefineOutput(item)
-			case 5:
-				r.Region = utils.RefineOutput(item)
-			case 6:
-				r.OwnerDomain = utils.RefineOutput(item)
-			case 7:
-				r.IspDomain = utils.RefineOutput(item)
-			case 8:
-				r.ChinaAdminCode, _ = utils.String2Int32(item)
-			case 9:
-				r.Latitude, _ = utils.String2Float64(item)
-			case 10:
-				r.Longitude, _ = utils.String2Float64(item)
-			case 11:
-				r.Timezone = utils.RefineOutput(item)
-			case 12:
-				r.CountryCode = utils.RefineOutput(item)
-			case 13:
-				if r.Asn, e = parseAsn(item); e != nil {
-					return e
-				}
-			case 14:
-				r.UsageType = utils.RefineOutput(item)
-			case 15:
-				r.Line = utils.RefineOutput(item)
-			}
-		}
-	} else {
-		return errors.New("meta is null")
-	}
-	return e
+	return r.UnmarshalColumns(splitRow(row), V4Columns)
 }
 
 // UnmarshalV6 Parse detailed information into meta format.
 func (r *RowMeta) UnmarshalV6(buffer []byte) error {
+	return r.UnmarshalColumns(splitRow(string(buffer)), V6Columns)
+}
+
+// UnmarshalColumns Parse the fields of a row, columns names the field at
+// each position. Fields beyond the named columns are kept as attributes
+// named after their position, e.g. col16. Invalid fields are zeroed and
+// reported together in the returned error.
+func (r *RowMeta) UnmarshalColumns(fields, columns []string) error {
+	if r == nil {
+		return errors.New("meta is null")
+	}
+	return joinFieldErrors(r.unmarshalColumns(fields, columns))
+}
+
+func (r *RowMeta) unmarshalColumns(fields, columns []string) []*FieldError {
+	var errs []*FieldError
+	for i, item := range fields {
+		name := fmt.Sprintf("col%d", i)
+		if i < len(columns) {
+			name = columns[i]
+		}
+		if err := r.setColumn(name, item); err != nil {
+			errs = append(errs, &FieldError{Column: name, Value: item, Err: err})
+		}
+	}
+	return errs
+}
+
+// setColumn Parse the field of the named column, the field is left zero
+// when the value is invalid.
+func (r *RowMeta) setColumn(name, item string) error {
 	var e error
-	if r != nil {
-		for i, item := range strings.Split(strings.TrimSuffix(string(buffer), "\n"), "\t") {
-			switch i {
-			case 0:
-				r.StartIP = item
-				_, ipv6Net, err := net.ParseCIDR(item)
-				if err != nil {
-					fmt.Println("ParseCIDR failed. err=", err.Error())
-					break
-				}
-				r.startIPObj = ipv6Net.IP
-				r.endIPObj = utils.LastIP(ipv6Net)
-			case 1:
-				r.Country = item
-			case 2:
-				r.Province = utils.RefineOutput(item)
-			case 3:
-				r.City = utils.RefineOutput(item)
-			case 4:
-				r.Region = utils.RefineOutput(item)
-			case 5:
-				r.OwnerDomain = utils.RefineOutput(item)
-			case 6:
-				r.IspDomain = utils.RefineOutput(item)
-			case 7:
-				r.ChinaAdminCode, _ = utils.String2Int32(item)
-			case 8:
-				r.Latitude, _ = utils.String2Float64(item)
-			case 9:
-				r.Longitude, _ = utils.String2Float64(item)
-			case 10:
-				r.Timezone = utils.RefineOutput(item)
-			case 11:
-				r.CountryCode = utils.RefineOutput(item)
-			case 12:
-				if r.Asn, e = parseAsn(item); e != nil {
-					return e
-				}
-			case 13:
-				r.UsageType = utils.RefineOutput(item)
-			case 14:
-				r.Line = utils.RefineOutput(item)
+	switch name {
+	case ColStartIP:
+		r.StartIP = item
+		if r.startIPObj = net.ParseIP(item); r.startIPObj == nil {
+			e = errors.New("invalid address")
+		}
+	case ColEndIP:
+		r.EndIP = item
+		if r.endIPObj = net.ParseIP(item); r.endIPObj == nil {
+			e = errors.New("invalid address")
+		}
+	case ColCIDR:
+		r.StartIP = item
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return errors.New("invalid cidr")
+		}
+		r.startIPObj = ipNet.IP
+		r.endIPObj = utils.LastIP(ipNet)
+	case ColCountry:
+		r.Country = utils.RefineOutput(item)
+	case ColProvince:
+		r.Province = utils.RefineOutput(item)
+	case ColCity:
+		r.City = utils.RefineOutput(item)
+	case ColRegion:
+		r.Region = utils.RefineOutput(item)
+	case ColOwnerDomain:
+		r.OwnerDomain = utils.RefineOutput(item)
+	case ColIspDomain:
+		r.IspDomain = utils.RefineOutput(item)
+	case ColChinaAdminCode:
+		if r.ChinaAdminCode, e = utils.String2Int32(item); e != nil {
+			r.ChinaAdminCode = 0
+		}
+	case ColLatitude:
+		r.Latitude, e = parseCoordinate(item, 90)
+	case ColLongitude:
+		r.Longitude, e = parseCoordinate(item, 180)
+	case ColTimezone:
+		r.Timezone = utils.RefineOutput(item)
+	case ColCountryCode:
+		r.CountryCode = utils.RefineOutput(item)
+	case ColAsn:
+		r.Asn, e = parseAsn(item)
+	case ColUsageType:
+		r.UsageType = utils.RefineOutput(item)
+	case ColLine:
+		r.Line = utils.RefineOutput(item)
+	case ColType:
+		r.Type = optionalString(item)
+	case ColComment:
+		r.Comment = optionalString(item)
+	default:
+		if item = utils.RefineOutput(item); item != "" {
+			if r.Attrs == nil {
+				r.Attrs = make(Attrs)
 			}
+			r.Attrs[name] = item
 		}
-	} else {
-		return errors.New("meta is null")
 	}
 	return e
 }
 
+// FieldError Define an invalid field of a row.
+type FieldError struct {
+	Column string // Column name, empty for errors of the whole row
+	Value  string // Raw value of the field
+	Err    error
+}
+
+// Error Format output
+func (e *FieldError) Error() string {
+	if e.Column == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("column %s: invalid value %q, %s", e.Column, e.Value, e.Err)
+}
+
+// Unwrap Return the underlying error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
 // Hash hash calculation
 func (r *RowMeta) Hash() string {
 	if r.IsEmpty() {
 		return ""
 	}
+	return r.Meta().hash()
+}
+
+// Meta Return the metadata part of the row.
+func (r *RowMeta) Meta() *Meta {
+	return &Meta{
+		Country:        r.Country,
+		Province:       r.Province,
+		City:           r.City,
+		Region:         r.Region,
+		OwnerDomain:    r.OwnerDomain,
+		IspDomain:      r.IspDomain,
+		ChinaAdminCode: r.ChinaAdminCode,
+		Latitude:       r.Latitude,
+		Longitude:      r.Longitude,
+		Timezone:       r.Timezone,
+		CountryCode:    r.CountryCode,
+		Asn:            r.Asn,
+		UsageType:      r.UsageType,
+		Line:           r.Line,
+		Comment:        r.Comment,
+		Type:           r.Type,
+		Attrs:          r.Attrs,
+	}
+}
+
+// Hash hash calculation, metas with the same hash are stored only once.
+func (m *Meta) Hash() string {
+	if m == nil || m.IsEmpty() {
+		return ""
+	}
+	return m.hash()
+}
+
+func (m *Meta) hash() string {
 	h1 := sha1.New()
-	source := fmt.Sprintf("%s%s%s%s%s%s%d%g%g%s%s%d%s%s", r.Country, r.Province, r.City, r.Region,
-		r.OwnerDomain, r.IspDomain, r.ChinaAdminCode, r.Latitude, r.Longitude,
-		r.Timezone, r.CountryCode, r.Asn, r.UsageType, r.Line)
+	source := fmt.Sprintf("%s%s%s%s%s%s%d%g%g%s%s%d%s%s%q%q", m.Country, m.Province, m.City, m.Region,
+		m.OwnerDomain, m.IspDomain, m.ChinaAdminCode, m.Latitude, m.Longitude,
+		m.Timezone, m.CountryCode, m.Asn, m.UsageType, m.Line,
+		stringValue(m.Type), stringValue(m.Comment))
 	_, _ = io.WriteString(h1, source)
+	// Quoted, so that values holding separators can't pass for other attributes
+	for _, k := range m.Attrs.keys() {
+		_, _ = fmt.Fprintf(h1, "%q%q", k, m.Attrs[k])
+	}
 	return string(h1.Sum(nil))
 }
 
 // Mode Type judgment
-func (r *RowMeta) Mode() int {
+func (r *RowMeta) Mode() string {
 	if r.startIPObj.To4() != nil {
 		return IPV4
 	} else if r.startIPObj.To16() != nil {
@@ -257,33 +378,125 @@ func (m *Meta) String() string {
 	if m != nil {
 		return fmt.Sprintf("country:%s province:%s city:%s region:%s"+
 			"owner_domain:%s isp_domain:%s china_admin_code:%d latitude:%g Longitude:%g"+
-			"timezone:%s country_code:%s asn:%d usage_type:%s line:%s",
+			"timezone:%s country_code:%s asn:%d usage_type:%s line:%s type:%s comment:%s attrs:%s",
 			m.Country, m.Province, m.City, m.Region,
 			m.OwnerDomain, m.IspDomain, m.ChinaAdminCode, m.Latitude, m.Longitude,
-			m.Timezone, m.CountryCode, m.Asn, m.UsageType, m.Line)
+			m.Timezone, m.CountryCode, m.Asn, m.UsageType, m.Line,
+			stringValue(m.Type), stringValue(m.Comment), m.Attrs)
 	}
 	return ""
 }
 
-// MarshalString Serialize data entities into strings.
+// MarshalString Serialize data entities into strings, in the text form of
+// MarshalText.
 func (m *Meta) MarshalString() (string, error) {
-	var line string
-	if m != nil {
-		line = fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%d\t%g\t%g\t%s\t%s\t%d\t%s\t%s",
-			m.Country, m.Province, m.City, m.Region,
-			m.OwnerDomain, m.IspDomain, m.ChinaAdminCode, m.Latitude, m.Longitude,
-			m.Timezone, m.CountryCode, m.Asn, m.UsageType, m.Line)
+	if m == nil {
+		return "", nil
 	}
-	return line, nil
+	text, err := m.MarshalText()
+	return string(text), err
 }
 
-// Marshal Serialize data entities into strings.
+// Marshal Serialize data entities into strings, in the text form of
+// MarshalText.
 func (m *Meta) Marshal() ([]byte, error) {
-	line, err := m.MarshalString()
-	return []byte(line), err
+	if m == nil {
+		return nil, nil
+	}
+	return m.MarshalText()
 }
 
+// Column Return the value of the named column as written in text files,
+// empty values are returned as an empty string.
+func (m *Meta) Column(name string) string {
+	if m == nil {
+		return ""
+	}
+	switch name {
+	case ColCountry:
+		return m.Country
+	case ColProvince:
+		return m.Province
+	case ColCity:
+		return m.City
+	case ColRegion:
+		return m.Region
+	case ColOwnerDomain:
+		return m.OwnerDomain
+	case ColIspDomain:
+		return m.IspDomain
+	case ColChinaAdminCode:
+		if m.ChinaAdminCode == 0 {
+			return ""
+		}
+		return strconv.FormatInt(int64(m.ChinaAdminCode), 10)
+	case ColLatitude:
+		return formatCoordinate(m.Latitude)
+	case ColLongitude:
+		return formatCoordinate(m.Longitude)
+	case ColTimezone:
+		return m.Timezone
+	case ColCountryCode:
+		return m.CountryCode
+	case ColAsn:
+		asn := make([]string, len(m.Asn))
+		for i, v := range m.Asn {
+			asn[i] = strconv.FormatInt(v, 10)
+		}
+		return strings.Join(asn, ",")
+	case ColUsageType:
+		return m.UsageType
+	case ColLine:
+		return m.Line
+	case ColType:
+		return stringValue(m.Type)
+	case ColComment:
+		return stringValue(m.Comment)
+	}
+	return m.Attrs[name]
+}
+
+func formatCoordinate(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// optionalString Return nil for empty fields.
+func optionalString(item string) *string {
+	if item = utils.RefineOutput(item); item == "" {
+		return nil
+	}
+	return &item
+}
+
+// stringValue Return the value of an optional string.
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// parseCoordinate Parse a latitude or longitude within [-limit, limit].
+func parseCoordinate(s string, limit float64) (float64, error) {
+	val, err := utils.String2Float64(s)
+	if err != nil {
+		return 0, err
+	}
+	if val < -limit || val > limit {
+		return 0, errors.New("coordinate out of range")
+	}
+	return val, nil
+}
+
+// parseAsn Parse a comma separated ASN list. A * stands for no ASN, as in
+// every other column, so that rows written by WriteText are read back.
 func parseAsn(s string) ([]int64, error) {
+	if s = utils.RefineOutput(s); s == "" {
+		return nil, nil
+	}
 	asn := make([]int64, 0)
 	array := strings.Split(s, ",")
 	for _, item := range array {
@@ -1,17 +1,41 @@
 // Package core provides data core logics for handling IPV4/6 address.
 package core
 
+import "crypto/ed25519"
+
 // CallBackFunc Callback function format definition
 type CallBackFunc func(meta *Meta) interface{}
 
 // FileInfo File configuration information
 type FileInfo struct {
-	Path string
-	Type int
+	Path      string // Local path, or http(s) URL fetched by Option.Fetcher
+	Type      string // Format name, see RegisterDecoder
+	Checksum  string // Expected SHA-256 of the file in hex, checked when set
+	Signature string // Detached signature checked with Option.TrustedKeys, Path + ".sig" by default
 }
 
+// ParseMode Define how rows with invalid fields are handled.
+type ParseMode int
+
+const (
+	// Strict Rows with any invalid field are rejected and reported.
+	Strict ParseMode = iota
+	// Lenient Invalid fields are zeroed and flagged in the load report.
+	Lenient
+)
+
 // Option config option
 type Option struct {
-	Files []FileInfo
-	CB    CallBackFunc
+	Files       []FileInfo
+	CB          CallBackFunc
+	Schema      *Schema             // Column layout of text files without header line
+	ParseMode   ParseMode           // Handling of invalid fields, Strict by default
+	Overlays    []Overlay           // Corrections consulted before the data files
+	History     int                 // Number of previous versions kept for Rollback
+	Fetcher     Fetcher             // Fetcher of remote data files, an HTTPFetcher by default
+	CacheDir    string              // Directory keeping remote data files and the last-known-good data, encrypted with the key of the data files and not kept with trusted keys
+	TrustedKeys []ed25519.PublicKey // Signers of the data files and patches, unsigned data, patches and edits are refused when set
+	Manifest    string              // Signed manifest of the data files, replacing their own signatures
+	Key         []byte              // AES-256 key of encrypted data files
+	KeyProvider KeyProvider         // Provider of the keys of encrypted data files, used instead of Key
 }
@@ -0,0 +1,165 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// Overlay Define a source of corrections layered on top of the base data,
+// such as office ranges or private network labels. Search consults the
+// overlays before the base data.
+type Overlay struct {
+	Name     string     // Name of the overlay, set as Meta.Source of its results
+	Priority int        // Overlays with higher priority are consulted first
+	Files    []FileInfo // Data files of the overlay
+}
+
+// overlayLayer Define a loaded overlay.
+type overlayLayer struct {
+	Overlay
+	store *Store
+}
+
+// Overlays Return the names of the loaded overlays in search order.
+func (s *Store) Overlays() []string {
+	overlays := s.loadedOverlays()
+	names := make([]string, len(overlays))
+	for i, layer := range overlays {
+		names[i] = layer.Name
+	}
+	return names
+}
+
+// loadedOverlays Return the loaded overlays in search order, the list is
+// never modified.
+func (s *Store) loadedOverlays() []*overlayLayer {
+	if overlays := s.overlays.Load(); overlays != nil {
+		return *overlays
+	}
+	return nil
+}
+
+// ReloadOverlay Reload the data files of the named overlay, the base data
+// and the other overlays are left untouched.
+func (s *Store) ReloadOverlay(name string) error {
+	var ov *Overlay
+	for _, layer := range s.loadedOverlays() {
+		if layer.Name == name {
+			ov = &layer.Overlay
+			break
+		}
+	}
+	if ov == nil {
+		return fmt.Errorf("unknown overlay %q", name)
+	}
+	return s.loadOverlay(*ov)
+}
+
+// loadOverlay Load the overlay into its own store and put it in place of
+// the overlay of the same name.
+func (s *Store) loadOverlay(ov Overlay) error {
+	started := time.Now()
+	layer, err := s.newOverlayLayer(ov)
+	if err != nil {
+		return err
+	}
+
+	defer s.deliverEvents()
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+	loaded := s.loadedOverlays()
+	overlays := make([]*overlayLayer, 0, len(loaded)+1)
+	for _, l := range loaded {
+		if l.Name != ov.Name {
+			overlays = append(overlays, l)
+		}
+	}
+	s.setOverlays(sortOverlays(append(overlays, layer)), started)
+	return nil
+}
+
+// loadOverlays Load the overlays of the option, which replace the loaded
+// overlays only once all of them have been loaded.
+func (s *Store) loadOverlays(opt Option) error {
+	started := time.Now()
+	overlays := make([]*overlayLayer, 0, len(opt.Overlays))
+	seen := make(map[string]bool, len(opt.Overlays))
+	for _, ov := range opt.Overlays {
+		if seen[ov.Name] {
+			return fmt.Errorf("duplicate overlay %q", ov.Name)
+		}
+		seen[ov.Name] = true
+		layer, err := s.newOverlayLayer(ov)
+		if err != nil {
+			return err
+		}
+		overlays = append(overlays, layer)
+	}
+
+	defer s.deliverEvents()
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+	s.setOverlays(sortOverlays(overlays), started)
+	return nil
+}
+
+// setOverlays Replace the loaded overlays and queue a reload event for
+// each overlay not loaded before. The caller holds editMu.
+func (s *Store) setOverlays(overlays []*overlayLayer, started time.Time) {
+	loaded := s.loadedOverlays()
+	prev := make(map[string]*overlayLayer, len(loaded))
+	for _, l := range loaded {
+		prev[l.Name] = l
+	}
+	version := s.Version()
+	for _, l := range overlays {
+		if prev[l.Name] == l {
+			continue
+		}
+		old := &snapshot{}
+		if p := prev[l.Name]; p != nil {
+			old = p.store.snapshot()
+		}
+		s.queueEvent(old, l.store.snapshot(), ReloadEvent{OldVersion: version, NewVersion: version, Overlay: l.Name,
+			Report: l.store.Report(), Duration: time.Since(started)})
+	}
+
+	s.overlays.Store(&overlays)
+}
+
+// newOverlayLayer Load the overlay into its own store.
+func (s *Store) newOverlayLayer(ov Overlay) (*overlayLayer, error) {
+	if len(ov.Files) == 0 {
+		return nil, fmt.Errorf("no incoming data file for overlay %q", ov.Name)
+	}
+	layer := &overlayLayer{Overlay: ov, store: NewStore()}
+	layer.store.source = ov.Name
+	s.mu.RLock()
+	opt := s.opt
+	s.mu.RUnlock()
+	opt.Files = ov.Files
+	opt.Overlays = nil
+	if err := layer.store.LoadData(opt); err != nil {
+		return nil, fmt.Errorf("load overlay %q error, %s", ov.Name, err)
+	}
+	return layer, nil
+}
+
+// sortOverlays Sort the overlays in search order.
+func sortOverlays(overlays []*overlayLayer) []*overlayLayer {
+	sort.SliceStable(overlays, func(i, j int) bool { return overlays[i].Priority > overlays[j].Priority })
+	return overlays
+}
+
+// searchOverlays Return the result of the first overlay holding the address.
+func (s *Store) searchOverlays(addr net.IP) *Meta {
+	for _, layer := range s.loadedOverlays() {
+		if m := layer.store.Search(addr); m != nil {
+			return m
+		}
+	}
+	return nil
+}
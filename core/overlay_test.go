@@ -0,0 +1,71 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestOverlays(t *testing.T) {
+	dir := t.TempDir()
+	office, vpn := dir+"/office.txt", dir+"/vpn.txt"
+	writeFile(t, office, "start_ip\tend_ip\tcountry\tcity\n1.55.29.0\t1.55.29.255\t中国\t办公室\n")
+	writeFile(t, vpn, "start_ip\tend_ip\tcountry\tcity\n1.55.0.0\t1.55.255.255\t中国\tVPN\n")
+
+	st := NewStore()
+	if err := st.LoadData(Option{
+		Files: []FileInfo{{Path: "testdata/v4.txt", Type: IPV4}},
+		Overlays: []Overlay{
+			{Name: "vpn", Priority: 1, Files: []FileInfo{{Path: vpn, Type: IPV4}}},
+			{Name: "office", Priority: 2, Files: []FileInfo{{Path: office, Type: IPV4}}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if names := st.Overlays(); strings.Join(names, ",") != "office,vpn" {
+		t.Errorf("unexpected overlay order %v", names)
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.City != "办公室" || m.Source != "office" {
+		t.Errorf("unexpected office result %v", m)
+	}
+	if m := st.Search(net.ParseIP("1.55.77.18")); m == nil || m.City != "VPN" || m.Source != "vpn" {
+		t.Errorf("unexpected vpn result %v", m)
+	}
+	if m := st.Search(net.ParseIP("1.20.177.1")); m == nil || m.Source != "" || m.Country != "泰国" {
+		t.Errorf("unexpected base result %v", m)
+	}
+
+	writeFile(t, office, "start_ip\tend_ip\tcountry\tcity\n1.55.28.0\t1.55.28.255\t中国\t办公室\n")
+	if err := st.ReloadOverlay("office"); err != nil {
+		t.Fatal(err)
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.Source != "vpn" {
+		t.Errorf("unexpected result after reload %v", m)
+	}
+	if m := st.Search(net.ParseIP("1.55.28.1")); m == nil || m.Source != "office" {
+		t.Errorf("unexpected result after reload %v", m)
+	}
+	if err := st.ReloadOverlay("missing"); err == nil {
+		t.Error("expected unknown overlay error")
+	}
+
+	// loading again replaces the overlays, all of them or none
+	opt := Option{
+		Files:    []FileInfo{{Path: "testdata/v4.txt", Type: IPV4}},
+		Overlays: []Overlay{{Name: "vpn", Files: []FileInfo{{Path: vpn, Type: IPV4}}}},
+	}
+	if err := st.LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+	if names := st.Overlays(); strings.Join(names, ",") != "vpn" {
+		t.Errorf("unexpected overlays %v after reload", names)
+	}
+	opt.Overlays = append(opt.Overlays, Overlay{Name: "broken", Files: []FileInfo{{Path: dir + "/missing.txt", Type: IPV4}}})
+	if err := st.LoadData(opt); err == nil {
+		t.Error("expected overlay load error")
+	}
+	if names := st.Overlays(); strings.Join(names, ",") != "vpn" {
+		t.Errorf("unexpected overlays %v after failed load", names)
+	}
+}
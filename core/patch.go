@@ -0,0 +1,215 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// patchHeader First line of a patch.
+const patchHeader = "# ipip patch 1"
+
+// Checksum Return the SHA-256 of the ranges and metas of the store,
+// identifying the version of the dataset. Adjacent ranges of identical
+// metas are hashed as one, so the checksum does not depend on how the
+// ranges were split.
+func (s *Store) Checksum() string {
+	h := sha256.New()
+	for _, family := range []string{IPV4, IPV6} {
+		var start, end netip.Addr
+		var last *Meta
+		flush := func() {
+			if last != nil {
+				text, _ := last.dataText()
+				_, _ = fmt.Fprintf(h, "%s\t%s\t%s\n", start, end, text)
+			}
+		}
+		s.Walk(family, func(first, until net.IP, meta *Meta) bool {
+			a, _ := netip.AddrFromSlice(first)
+			b, _ := netip.AddrFromSlice(until)
+			a, b = a.Unmap(), b.Unmap()
+			if last != nil && end.Next() == a && last.Hash() == meta.Hash() {
+				end = b
+				return true
+			}
+			flush()
+			start, end, last = a, b, meta
+			return true
+		})
+		flush()
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MakePatch Write the patch turning the old dataset into the current one.
+// A patch is a text file: a header, the checksums of both datasets, then
+// one line per range to delete (-) or to set (+):
+//
+//	# ipip patch 1
+//	base	<checksum of old>
+//	target	<checksum of cur>
+//	-	ipv4	10.0.3.0	10.0.3.255
+//	+	ipv4	10.0.4.0	10.0.4.255	<meta text form>
+func MakePatch(w io.Writer, old, cur *Store) error {
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintf(bw, "%s\nbase\t%s\ntarget\t%s\n", patchHeader, old.Checksum(), cur.Checksum())
+	for _, d := range Diff(old, cur).Ranges {
+		if d.Kind == DiffRemoved {
+			_, _ = fmt.Fprintf(bw, "-\t%s\t%s\t%s\n", d.Family, d.Start, d.End)
+			continue
+		}
+		text, err := d.New.dataText()
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(bw, "+\t%s\t%s\t%s\t%s\n", d.Family, d.Start, d.End, text)
+	}
+	return bw.Flush()
+}
+
+// ErrUnsigned Returned when applying a patch without signature to a store
+// with Option.TrustedKeys, see ApplyPatchFile.
+var ErrUnsigned = errors.New("unsigned patch refused, the store only accepts signed data")
+
+// ApplyPatch Apply a patch made by MakePatch. The patch is refused unless
+// the store holds its base version, and the result is published as a new
+// version only when it matches the target version.
+// With Option.TrustedKeys the patch is refused, as it carries no
+// signature, use ApplyPatchFile instead.
+func (s *Store) ApplyPatch(r io.Reader) error {
+	if s.immutable {
+		return ErrImmutable
+	}
+	started := time.Now()
+	defer s.deliverEvents()
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+	if len(s.opt.TrustedKeys) > 0 {
+		return ErrUnsigned
+	}
+	return s.applyPatch(r, started)
+}
+
+// ApplyPatchFile Apply the patch file like ApplyPatch. The patch file is
+// checked like the data files: against fn.Checksum, and with
+// Option.TrustedKeys against its entry in Option.Manifest or its detached
+// signature.
+func (s *Store) ApplyPatchFile(fn FileInfo) error {
+	if s.immutable {
+		return ErrImmutable
+	}
+	started := time.Now()
+	defer s.deliverEvents()
+	path := fn.Path
+	if isRemote(path) {
+		s.mu.RLock()
+		opt := s.opt
+		s.mu.RUnlock()
+		local, done, err := fetch(opt, fn)
+		if err != nil {
+			return fmt.Errorf("fetch %s error, %s", fn.Path, err)
+		}
+		defer done()
+		path = local
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+
+	digest := sha256.Sum256(data)
+	if fn.Checksum != "" && !strings.EqualFold(hex.EncodeToString(digest[:]), fn.Checksum) {
+		return fmt.Errorf("checksum mismatch, got sha256 %x, want %s", digest, fn.Checksum)
+	}
+	manifest, err := s.loadManifest()
+	if err != nil {
+		return fmt.Errorf("load manifest %s error, %s", s.opt.Manifest, err)
+	}
+	if err = s.verifyFile(fn, digest[:], manifest); err != nil {
+		return fmt.Errorf("verify patch %s error, %s", fn.Path, err)
+	}
+	return s.applyPatch(bytes.NewReader(data), started)
+}
+
+// applyPatch Apply the patch, the caller holds editMu.
+func (s *Store) applyPatch(r io.Reader, started time.Time) error {
+	br := bufio.NewReader(r)
+	if header, err := br.ReadString('\n'); strings.TrimRight(header, "\r\n") != patchHeader {
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return errors.New("not an ipip patch")
+	}
+
+	var base, target string
+	snap := s.snapshot()
+	n := 0
+	err := readLines(br, func(line int, text string) error {
+		n++
+		line++ // The header line was read above
+		fields := strings.SplitN(text, "\t", 5)
+		switch {
+		case n == 1 && fields[0] == "base" && len(fields) == 2:
+			base = fields[1]
+			if sum := s.Checksum(); sum != base {
+				return fmt.Errorf("patch base %s does not match store version %s", base, sum)
+			}
+			return nil
+		case n == 2 && fields[0] == "target" && len(fields) == 2:
+			target = fields[1]
+			return nil
+		case n <= 2:
+			return fmt.Errorf("line %d: missing patch version", line)
+		}
+
+		if len(fields) < 4 || (fields[0] == "+" && len(fields) != 5) {
+			return fmt.Errorf("line %d: bad patch line", line)
+		}
+		start, err1 := netip.ParseAddr(fields[2])
+		end, err2 := netip.ParseAddr(fields[3])
+		if err1 != nil || err2 != nil || (fields[1] == IPV4) != start.Is4() {
+			return fmt.Errorf("line %d: bad patch range", line)
+		}
+		var meta *Meta
+		switch fields[0] {
+		case "-":
+		case "+":
+			meta = &Meta{}
+			if err := meta.UnmarshalText([]byte(fields[4])); err != nil {
+				return fmt.Errorf("line %d: %s", line, err)
+			}
+			if s.opt.CB != nil {
+				meta.Extends = s.opt.CB(meta)
+			}
+		default:
+			return fmt.Errorf("line %d: unknown patch operation %q", line, fields[0])
+		}
+		if err := snap.splice(start, end, meta); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if target == "" {
+		return errors.New("empty patch")
+	}
+	if sum := snap.store().Checksum(); sum != target {
+		return fmt.Errorf("patched version %s does not match target %s", sum, target)
+	}
+	s.commit(snap, s.Report(), started)
+	return nil
+}
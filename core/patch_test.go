@@ -0,0 +1,68 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	cn, jp := &Meta{Country: "中国", City: "上海"}, &Meta{Country: "日本"}
+	ob := NewBuilder()
+	_ = ob.AddPrefix(netip.MustParsePrefix("10.0.0.0/23"), cn)
+	_ = ob.AddPrefix(netip.MustParsePrefix("10.0.2.0/23"), jp)
+	_ = ob.AddPrefix(netip.MustParsePrefix("2001:db8::/32"), cn)
+	old, _ := ob.Build()
+
+	nb := NewBuilder()
+	_ = nb.AddPrefix(netip.MustParsePrefix("10.0.0.0/24"), cn)
+	_ = nb.AddPrefix(netip.MustParsePrefix("10.0.1.0/24"), &Meta{Country: "中国", City: "北京"})
+	_ = nb.AddPrefix(netip.MustParsePrefix("10.0.2.0/24"), jp)
+	_ = nb.AddPrefix(netip.MustParsePrefix("10.0.4.0/24"), jp)
+	_ = nb.AddPrefix(netip.MustParsePrefix("2001:db8::/33"), cn)
+	cur, _ := nb.Build()
+
+	var patch strings.Builder
+	if err := MakePatch(&patch, old, cur); err != nil {
+		t.Fatal(err)
+	}
+
+	// a live copy of the old store
+	st := NewStore()
+	var buf strings.Builder
+	_ = old.WriteText(&buf, IPV4)
+	_ = st.UnmarshalFrom(strings.NewReader(buf.String()), IPV4)
+	buf.Reset()
+	_ = old.WriteText(&buf, IPV6)
+	_ = st.UnmarshalFrom(strings.NewReader(buf.String()), IPV6)
+
+	if err := st.ApplyPatch(strings.NewReader(patch.String())); err != nil {
+		t.Fatalf("%s\n%s", err, patch.String())
+	}
+	if st.Checksum() != cur.Checksum() {
+		t.Errorf("patched store differs from the new one\n%s", patch.String())
+	}
+	for addr, want := range map[string]string{
+		"10.0.1.1": "中国北京", "10.0.3.1": "", "10.0.4.1": "日本", "2001:db8:8000::1": "",
+	} {
+		got := ""
+		if m := st.Search(net.ParseIP(addr)); m != nil {
+			got = m.Country + m.City
+		}
+		if got != want {
+			t.Errorf("Search(%s) = %q, want %q", addr, got, want)
+		}
+	}
+
+	if err := st.ApplyPatch(strings.NewReader(patch.String())); err == nil || !strings.Contains(err.Error(), "does not match store version") {
+		t.Errorf("expected base version error, got %v", err)
+	}
+	if err := st.ApplyPatch(strings.NewReader("10.0.0.0\t10.0.0.255\n")); err == nil {
+		t.Error("expected error for missing patch header")
+	}
+	if err := old.ApplyPatch(strings.NewReader(patch.String())); err != ErrImmutable {
+		t.Errorf("got %v, want ErrImmutable", err)
+	}
+}
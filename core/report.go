@@ -0,0 +1,48 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import "fmt"
+
+// FileReport Define the load result of a single data file.
+type FileReport struct {
+	Path        string // Path of the data file
+	Type        string // Format name configured in FileInfo.Type
+	Detected    string // Format name used to decode the file
+	Compression string // Compression of the file, empty when uncompressed
+	Encrypted   bool   // Whether the file was encrypted
+	Info        Info   // Metadata declared by the file or its sidecar file
+	Columns     int    // Column count of the first data row
+	IPV4Count   int    // Number of IPv4 ranges loaded
+	IPV6Count   int    // Number of IPv6 ranges loaded
+	Rows        int    // Number of data rows read
+	Rejected    int    // Number of rows rejected
+	Flagged     int    // Number of rows loaded with invalid fields zeroed
+	Errors      []RowError
+}
+
+// maxReportErrors Maximum number of row errors kept in a FileReport.
+const maxReportErrors = 100
+
+// RowError Define the problem of a rejected or flagged row.
+type RowError struct {
+	Line int // Line number of the row, 0 if unknown
+	Err  error
+}
+
+// Error Format output
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (r *FileReport) addError(line int, err error) {
+	if len(r.Errors) < maxReportErrors {
+		r.Errors = append(r.Errors, RowError{Line: line, Err: err})
+	}
+}
+
+// LoadReport Define the result of the last load of a store.
+type LoadReport struct {
+	Files []FileReport
+	Stale bool  // Data loaded from the last-known-good cache, see Option.CacheDir
+	Err   error // Error of the data files, when Stale
+}
@@ -0,0 +1,172 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Column names understood by the text decoders.
+const (
+	ColStartIP        = "start_ip"
+	ColEndIP          = "end_ip"
+	ColCIDR           = "cidr"
+	ColCountry        = "country"
+	ColProvince       = "province"
+	ColCity           = "city"
+	ColRegion         = "region"
+	ColOwnerDomain    = "owner_domain"
+	ColIspDomain      = "isp_domain"
+	ColChinaAdminCode = "china_admin_code"
+	ColLatitude       = "latitude"
+	ColLongitude      = "longitude"
+	ColTimezone       = "timezone"
+	ColCountryCode    = "country_code"
+	ColAsn            = "asn"
+	ColUsageType      = "usage_type"
+	ColLine           = "line"
+	ColType           = "type"
+	ColComment        = "comment"
+)
+
+var (
+	// V4Columns Column layout of the ipip IPv4 data file.
+	V4Columns = []string{ColStartIP, ColEndIP, ColCountry, ColProvince, ColCity, ColRegion,
+		ColOwnerDomain, ColIspDomain, ColChinaAdminCode, ColLatitude, ColLongitude,
+		ColTimezone, ColCountryCode, ColAsn, ColUsageType, ColLine}
+	// V6Columns Column layout of the ipip IPv6 data file.
+	V6Columns = []string{ColCIDR, ColCountry, ColProvince, ColCity, ColRegion,
+		ColOwnerDomain, ColIspDomain, ColChinaAdminCode, ColLatitude, ColLongitude,
+		ColTimezone, ColCountryCode, ColAsn, ColUsageType, ColLine}
+)
+
+// columnAliases Other names of the columns accepted in header lines.
+var columnAliases = map[string]string{
+	"network_type": ColType,
+	"remark":       ColComment,
+}
+
+var knownColumns = func() map[string]bool {
+	known := make(map[string]bool)
+	for _, name := range V4Columns {
+		known[name] = true
+	}
+	for _, name := range V6Columns {
+		known[name] = true
+	}
+	known[ColType], known[ColComment] = true, true
+	return known
+}()
+
+// Schema Define the column layout of a text data file.
+// A file may start with a header line naming its columns, otherwise the
+// layout is taken from Columns, or from the default layout of the family.
+// Columns with names other than the Col constants are refused, unless
+// Attrs is set to keep them as Meta.Attrs.
+type Schema struct {
+	Columns     []string          // Column names in file order, for files without header line
+	Fields      map[string]string // Maps column names used by the vendor to the names above
+	Attrs       bool              // Keep columns with unknown names as Meta.Attrs
+	NetworkType bool              // Read the column after the default layout as ColType, see IPIPSchema
+}
+
+// IPIPSchema Return the schema of the ipip.net files without header line
+// that carry the network type after the default layout of the family, such
+// as IDC or anycast. Without it, that column is kept as the col16
+// attribute of IPv4 rows and col15 of IPv6 rows.
+func IPIPSchema() *Schema {
+	return &Schema{NetworkType: true}
+}
+
+// Resolve Translate the column names of a layout and validate it.
+func (sc *Schema) Resolve(names []string) ([]string, error) {
+	columns := make([]string, len(names))
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		name, known := sc.columnName(name)
+		if !known && name == "" {
+			return nil, fmt.Errorf("empty name of column %d", i)
+		} else if !known && (sc == nil || !sc.Attrs) {
+			return nil, fmt.Errorf("unknown column %q", names[i])
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %q", names[i])
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+	if !seen[ColCIDR] && !(seen[ColStartIP] && seen[ColEndIP]) {
+		return nil, fmt.Errorf("layout has neither %s nor %s and %s columns", ColCIDR, ColStartIP, ColEndIP)
+	}
+	return columns, nil
+}
+
+// columnName Return the column a name of a layout stands for, and whether
+// it is one of the Col constants.
+func (sc *Schema) columnName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if sc != nil {
+		if field, ok := sc.Fields[name]; ok {
+			name = field
+		}
+	}
+	lower := strings.ToLower(name)
+	if knownColumns[lower] {
+		return lower, true
+	}
+	if alias, ok := columnAliases[lower]; ok {
+		return alias, true
+	}
+	return name, false
+}
+
+// columns Return the layout of files without header line, and the number
+// of columns every row must have. The type and comment columns are not part
+// of the default layouts, files using them need a header line or a Schema,
+// the network type column of NetworkType is optional.
+func (sc *Schema) columns(family string) ([]string, int, error) {
+	if sc != nil && len(sc.Columns) > 0 {
+		columns, err := sc.Resolve(sc.Columns)
+		return columns, len(columns), err
+	}
+	columns := V4Columns
+	if family == IPV6 {
+		columns = V6Columns
+	}
+	if sc != nil && sc.NetworkType {
+		return append(append([]string{}, columns...), ColType), len(columns), nil
+	}
+	return columns, len(columns), nil
+}
+
+// isHeader Report whether a row names columns instead of holding data,
+// data rows always start with an address or a CIDR.
+func isHeader(fields []string) bool {
+	if len(fields) == 0 || net.ParseIP(fields[0]) != nil {
+		return false
+	}
+	_, _, err := net.ParseCIDR(fields[0])
+	return err != nil
+}
+
+// isHeaderRow Report whether the first row of a file is its header line.
+// With Columns, the row must be a valid layout, otherwise its first field
+// must name a column, so that a malformed first data row is rejected as a
+// row rather than failing the file.
+func (sc *Schema) isHeaderRow(fields []string) bool {
+	if !isHeader(fields) {
+		return false
+	}
+	if sc != nil && len(sc.Columns) > 0 {
+		_, err := sc.Resolve(fields)
+		return err == nil
+	}
+	_, known := sc.columnName(fields[0])
+	return known || (sc != nil && sc.Attrs)
+}
+
+// splitRow Split a text row into fields.
+func splitRow(row string) []string {
+	return strings.Split(strings.TrimRight(row, "\r\n"), "\t")
+}
@@ -0,0 +1,101 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"math"
+	"net"
+	"net/netip"
+	"sort"
+)
+
+// span Define a range of a store, IPv6 ranges by their upper 64 bits.
+type span struct {
+	start, end uint64
+	meta       *Meta
+}
+
+// segments Split the ranges of the family of all stores at every boundary
+// and call fn for each resulting segment covered by at least one store.
+// covering holds the meta of every store for the segment, nil for stores
+// not covering it.
+func segments(family string, stores []*Store, fn func(start, end uint64, covering []*Meta) error) error {
+	max := uint64(math.MaxUint32)
+	if family == IPV6 {
+		max = math.MaxUint64
+	}
+	spans := make([][]span, len(stores))
+	var bounds []uint64
+	for i, st := range stores {
+		st.Walk(family, func(start, end net.IP, meta *Meta) bool {
+			sp := span{start: rangeIndex(start), end: rangeIndex(end), meta: meta}
+			spans[i] = append(spans[i], sp)
+			bounds = append(bounds, sp.start)
+			if sp.end != max {
+				bounds = append(bounds, sp.end+1)
+			}
+			return true
+		})
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	pos := make([]int, len(stores))
+	covering := make([]*Meta, len(stores))
+	for i, start := range bounds {
+		if i > 0 && start == bounds[i-1] {
+			continue
+		}
+		end := max
+		for _, next := range bounds[i+1:] {
+			if next != start {
+				end = next - 1
+				break
+			}
+		}
+		found := false
+		for j := range spans {
+			for pos[j] < len(spans[j]) && spans[j][pos[j]].end < start {
+				pos[j]++
+			}
+			covering[j] = nil
+			if pos[j] < len(spans[j]) && spans[j][pos[j]].start <= start {
+				covering[j] = spans[j][pos[j]].meta
+				found = true
+			}
+		}
+		if !found {
+			continue
+		}
+		if err := fn(start, end, covering); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeIndex Return the index of an address of a range, the upper 64 bits
+// for IPv6.
+func rangeIndex(ip net.IP) uint64 {
+	if v4 := ip.To4(); v4 != nil {
+		return uint64(v4[0])<<24 | uint64(v4[1])<<16 | uint64(v4[2])<<8 | uint64(v4[3])
+	}
+	var index uint64
+	for _, b := range ip.To16()[:8] {
+		index = index<<8 | uint64(b)
+	}
+	return index
+}
+
+// indexAddr Return the address of an index, last selects the last address
+// of the /64 for IPv6.
+func indexAddr(family string, index uint64, last bool) netip.Addr {
+	if family == IPV4 {
+		addr, _ := netip.AddrFromSlice(v4IP(uint32(index)))
+		return addr
+	}
+	low := uint64(0)
+	if last {
+		low = math.MaxUint64
+	}
+	addr, _ := netip.AddrFromSlice(v6IP(index, low))
+	return addr
+}
@@ -0,0 +1,147 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// signatureSuffix Suffix of the default detached signature of a file.
+const signatureSuffix = ".sig"
+
+// Sign Return the detached signature of the content of r: the ed25519
+// signature of its SHA-256 digest, encoded in base64.
+func Sign(key ed25519.PrivateKey, r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	sig := ed25519.Sign(key, h.Sum(nil))
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), nil
+}
+
+// SignFile Write the detached signature of the file next to it, in the
+// file of the same name ending with .sig.
+func SignFile(key ed25519.PrivateKey, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	sig, err := Sign(key, f)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name+signatureSuffix, sig, 0o644)
+}
+
+// verifySignature Check that sig is a valid signature of the digest by one
+// of the keys.
+func verifySignature(keys []ed25519.PublicKey, digest, sig []byte) error {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return errors.New("malformed signature")
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, digest, raw) {
+			return nil
+		}
+	}
+	return errors.New("signature not made by a trusted key")
+}
+
+// verifyFile Check the SHA-256 digest of a loaded data file against the
+// manifest, or against its detached signature without manifest.
+// Nothing is checked without trusted keys.
+func (s *Store) verifyFile(fn FileInfo, digest []byte, manifest map[string]string) error {
+	if len(s.opt.TrustedKeys) == 0 {
+		return nil
+	}
+	if manifest != nil {
+		name := path.Base(fn.Path)
+		want, ok := manifest[name]
+		if !ok {
+			return fmt.Errorf("%s not listed in manifest", name)
+		}
+		if want != hex.EncodeToString(digest) {
+			return fmt.Errorf("sha256 of %s does not match manifest", name)
+		}
+		return nil
+	}
+	sigPath := fn.Signature
+	if sigPath == "" {
+		sigPath = fn.Path + signatureSuffix
+	}
+	sig, err := s.readFile(sigPath)
+	if err != nil {
+		return fmt.Errorf("read signature error, %s", err)
+	}
+	return verifySignature(s.opt.TrustedKeys, digest, sig)
+}
+
+// loadManifest Read the signed manifest of the option, it lists the
+// SHA-256 of the data files by base name, in the format of sha256sum.
+// The manifest is signed by its detached signature.
+func (s *Store) loadManifest() (map[string]string, error) {
+	if s.opt.Manifest == "" || len(s.opt.TrustedKeys) == 0 {
+		return nil, nil
+	}
+	data, err := s.readFile(s.opt.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.readFile(s.opt.Manifest + signatureSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("read signature error, %s", err)
+	}
+	digest := sha256.Sum256(data)
+	if err = verifySignature(s.opt.TrustedKeys, digest[:], sig); err != nil {
+		return nil, err
+	}
+
+	manifest := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("bad manifest line %q", sc.Text())
+		}
+		// sha256sum marks binary mode files with a '*'
+		manifest[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return manifest, sc.Err()
+}
+
+// readFile Read a small local or remote file.
+func (s *Store) readFile(name string) ([]byte, error) {
+	if !isRemote(name) {
+		return os.ReadFile(name)
+	}
+	fetcher := s.opt.Fetcher
+	if fetcher == nil {
+		fetcher = &HTTPFetcher{Retries: 2}
+	}
+	resp, err := fetcher.Fetch(context.Background(), &FetchRequest{URL: name})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Body == nil {
+		return nil, errors.New("empty response")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -0,0 +1,129 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(nil)
+	other, _, _ := ed25519.GenerateKey(nil)
+	dir := t.TempDir()
+	path := dir + "/v4.txt"
+	writeFile(t, path, "1.55.0.0\t1.55.255.255\t中国\t上海\n")
+
+	opt := Option{Files: []FileInfo{{Path: path, Type: IPV4}}, TrustedKeys: []ed25519.PublicKey{pub}, ParseMode: Lenient}
+	st := NewStore()
+	if err := st.LoadData(opt); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("expected missing signature error, got %v", err)
+	}
+	if err := SignFile(key, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+
+	// tampered file, the loaded data must be kept and the file is not
+	// decoded before it is verified
+	writeFile(t, path, "1.55.0.0\t1.55.255.255\t中国\t北京\n")
+	decoded := 0
+	st.opt.CB = func(*Meta) interface{} { decoded++; return nil }
+	if err := st.Update(); err == nil || !strings.Contains(err.Error(), "not made by a trusted key") {
+		t.Errorf("expected signature error, got %v", err)
+	}
+	if decoded != 0 {
+		t.Errorf("callback ran on %d metas of an unverified file", decoded)
+	}
+	st.opt.CB = nil
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.Province != "上海" {
+		t.Errorf("unexpected result %v", m)
+	}
+	// the unsigned sidecar file is ignored
+	writeFile(t, path, "#@vendor: ipip.net\n1.55.0.0\t1.55.255.255\t中国\t上海\n")
+	_ = SignFile(key, path)
+	if err := os.WriteFile(path+infoSuffix, []byte(`{"vendor":"forged"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Update(); err != nil || st.Info().Vendor != "ipip.net" {
+		t.Errorf("unexpected info %+v, %v", st.Info(), err)
+	}
+	_ = os.Remove(path + infoSuffix)
+	writeFile(t, path, "1.55.0.0\t1.55.255.255\t中国\t北京\n")
+
+	opt.TrustedKeys = []ed25519.PublicKey{other}
+	_ = SignFile(key, path)
+	if err := NewStore().LoadData(opt); err == nil {
+		t.Error("expected error for untrusted key")
+	}
+
+	// signed manifest
+	sum := sha256.Sum256([]byte("1.55.0.0\t1.55.255.255\t中国\t北京\n"))
+	manifest := dir + "/SHA256SUMS"
+	if err := os.WriteFile(manifest, []byte(fmt.Sprintf("%x  v4.txt\n", sum)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_ = SignFile(key, manifest)
+	_ = os.Remove(path + ".sig")
+	opt.TrustedKeys, opt.Manifest = []ed25519.PublicKey{pub}, manifest
+	if err := st.LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "1.55.0.0\t1.55.255.255\t中国\t天津\n")
+	if err := st.Update(); err == nil || !strings.Contains(err.Error(), "does not match manifest") {
+		t.Errorf("expected manifest error, got %v", err)
+	}
+}
+
+func TestSignedPatch(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(nil)
+	dir := t.TempDir()
+	path := dir + "/v4.txt"
+	if err := os.WriteFile(path, []byte("start_ip\tend_ip\tcountry\tprovince\n1.55.0.0\t1.55.255.255\t中国\t上海\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_ = SignFile(key, path)
+	st := NewStore()
+	if err := st.LoadData(Option{Files: []FileInfo{{Path: path, Type: IPV4}}, TrustedKeys: []ed25519.PublicKey{pub}}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBuilder()
+	_ = b.AddPrefix(netip.MustParsePrefix("1.55.0.0/16"), &Meta{Country: "中国", Province: "北京"})
+	cur, _ := b.Build()
+	var patch strings.Builder
+	if err := MakePatch(&patch, st, cur); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ApplyPatch(strings.NewReader(patch.String())); err != ErrUnsigned {
+		t.Errorf("got %v, want ErrUnsigned", err)
+	}
+	patchPath := dir + "/v4.patch"
+	if err := os.WriteFile(patchPath, []byte(patch.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ApplyPatchFile(FileInfo{Path: patchPath}); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("expected missing signature error, got %v", err)
+	}
+	if err := st.Set(netip.MustParsePrefix("1.55.0.0/24"), &Meta{Country: "日本"}); err != ErrUnsignedEdit {
+		t.Errorf("got %v, want ErrUnsignedEdit", err)
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.Province != "上海" {
+		t.Fatalf("refused changes modified the data, got %v", m)
+	}
+
+	_ = SignFile(key, patchPath)
+	if err := st.ApplyPatchFile(FileInfo{Path: patchPath}); err != nil {
+		t.Fatal(err)
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.Province != "北京" {
+		t.Errorf("unexpected result after signed patch %v", m)
+	}
+}
@@ -2,15 +2,20 @@
 package core
 
 import (
-	"bufio"
+	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/universal-fraternity/ipip/utils"
 )
@@ -21,9 +26,22 @@ type Store struct {
 	ipv6EntityList []*IPV6Entity
 	v6MateList     []*Meta
 	v4MateList     []*Meta
-	opt            Option
+	opt            Option // Written holding both editMu and mu, read holding either
+	report         LoadReport
+	overlays       atomic.Pointer[[]*overlayLayer] // Loaded overlays in search order, replaced holding editMu
+	source         string
+	versions       []*version  // Retained versions, oldest first
+	current        int         // Index of the published version in versions
+	files          []fileState // State of the data files at the last load
+	info           Info        // Metadata of the published data
+	hooks          []*reloadHook
+	events         []ReloadEvent // Reload events waiting for delivery
+	delivering     bool          // Whether events are being delivered
+	immutable      bool
 	v4Mu           sync.RWMutex
 	v6Mu           sync.RWMutex
+	mu             sync.RWMutex // Guards report, versions, files, info and reload events
+	editMu         sync.Mutex
 }
 
 // NewStore returns a new store.
@@ -34,7 +52,11 @@ func NewStore() *Store {
 // WithDataFiles Set data file
 func (s *Store) WithDataFiles(fs []FileInfo) {
 	if s != nil && len(fs) > 0 {
+		s.editMu.Lock()
+		s.mu.Lock()
 		s.opt.Files = fs
+		s.mu.Unlock()
+		s.editMu.Unlock()
 	}
 }
 
@@ -77,24 +99,21 @@ func (s *Store) Search(addr net.IP) *Meta {
 	if addr == nil {
 		return nil
 	}
+	if m := s.searchOverlays(addr); m != nil {
+		return m
+	}
 	if utils.IsIPv4(addr.String()) {
 		// IPv4
 		s.v4Mu.RLock()
 		defer s.v4Mu.RUnlock()
 
 		ipIndex := binary.BigEndian.Uint32(addr.To4())
-		if index := sort.Search(s.IPV4EntityCount(), func(i int) bool {
-			// Find the index of the first IPIndex greater than or equal to the given IP
-			return s.ipv4EntityList[i].StartIndex() >= ipIndex
-		}); s.IPV4Entity(index) != nil {
-			if s.IPV4Entity(index).StartIndex() != ipIndex {
-				index -= 1
-			}
-			if index < 0 {
-				return nil
-			}
-
-			v4Entity := s.IPV4Entity(index)
+		// Find the index of the first IPIndex greater than the given IP,
+		// the entity before it is the only one that may contain the IP.
+		index := sort.Search(s.IPV4EntityCount(), func(i int) bool {
+			return s.ipv4EntityList[i].StartIndex() > ipIndex
+		}) - 1
+		if v4Entity := s.IPV4Entity(index); v4Entity != nil {
 			if v4Entity.StartIndex() <= ipIndex && v4Entity.EndIndex() >= ipIndex {
 				mi := v4Entity.metaIndex
 				return s.v4MateList[mi]
@@ -106,18 +125,12 @@ func (s *Store) Search(addr net.IP) *Meta {
 		defer s.v6Mu.RUnlock()
 
 		ipIndex := binary.BigEndian.Uint64(addr.To16())
-		if index := sort.Search(s.IPV6EntityCount(), func(i int) bool {
-			// Find the index of the first IPIndex greater than or equal to the given IP
-			return s.ipv6EntityList[i].StartIndex() >= ipIndex
-		}); s.IPV6Entity(index) != nil {
-			if s.IPV6Entity(index).StartIndex() != ipIndex {
-				index -= 1
-			}
-			if index < 0 {
-				return nil
-			}
-
-			v6Entity := s.IPV6Entity(index)
+		// Find the index of the first IPIndex greater than the given IP,
+		// the entity before it is the only one that may contain the IP.
+		index := sort.Search(s.IPV6EntityCount(), func(i int) bool {
+			return s.ipv6EntityList[i].StartIndex() > ipIndex
+		}) - 1
+		if v6Entity := s.IPV6Entity(index); v6Entity != nil {
 			if v6Entity.StartIndex() <= ipIndex && v6Entity.EndIndex() >= ipIndex {
 				mi := v6Entity.metaIndex
 				return s.v6MateList[mi]
@@ -127,55 +140,81 @@ func (s *Store) Search(addr net.IP) *Meta {
 	return nil
 }
 
-// UnmarshalFrom Decompose and store from raeder.
-func (s *Store) UnmarshalFrom(reader io.Reader, t int) error {
-	if t == Unknown {
-		return errors.New("unknown data type")
+// Report Return the report of the last load.
+func (s *Store) Report() LoadReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.report
+}
+
+// UnmarshalFrom Decompose and store from raeder, t is the format name of
+// a registered decoder or Auto.
+func (s *Store) UnmarshalFrom(reader io.Reader, t string) error {
+	if s.immutable {
+		return ErrImmutable
+	}
+	started := time.Now()
+	defer s.deliverEvents()
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+	snap := s.snapshot()
+	reader, encrypted, err := s.decrypt(FileInfo{Type: t}, reader)
+	if err != nil {
+		return err
+	}
+	fr, err := s.unmarshalFrom(reader, t, snap)
+	if err != nil {
+		return err
+	}
+	fr.Encrypted = encrypted
+	if !fr.Info.IsZero() {
+		snap.info = fr.Info
+	}
+	s.commit(snap, LoadReport{Files: []FileReport{fr}}, started)
+	return nil
+}
+
+// unmarshalFrom Decode the reader into the snapshot, the ranges of the
+// families found in the reader replace those of the snapshot.
+func (s *Store) unmarshalFrom(reader io.Reader, t string, snap *snapshot) (FileReport, error) {
+	report := FileReport{Type: t}
+	reader, t, err := sniff(reader, t, s.opt.ParseMode, &report)
+	if err != nil {
+		return report, err
+	}
+	dec, ok := LookupDecoder(t)
+	if !ok {
+		return report, fmt.Errorf("unknown data type %q", t)
+	}
+	if c, ok := dec.(Configurable); ok {
+		dec = c.Configure(s.opt)
 	}
 
-	var err error
 	ipv4List := make([]*IPV4Entity, 0)
 	ipv6List := make([]*IPV6Entity, 0)
 	metaTable := make(map[string]uint32)
 	tmpMetaList := make([]*Meta, 0)
-	iReader := bufio.NewReader(reader)
-	for {
-		var line []byte
-		if line, err = iReader.ReadBytes('\n'); err != nil {
-			break
+	err = dec.Decode(reader, func(rec *Record) error {
+		report.Rows++
+		if rec.Err == nil {
+			rec.Err = validRecord(rec)
 		}
-		rowMeta := &RowMeta{}
-		if err = rowMeta.Unmarshal(line, t); err != nil {
-			_, _ = fmt.Fprint(os.Stderr, "meta unmarshal error, ", err.Error(), string(line))
-			continue
+		if rec.Err != nil {
+			report.Rejected++
+			report.addError(rec.Line, rec.Err)
+			return nil
 		}
-		fp := rowMeta.Hash()
-		if fp == "" {
-			// Fingerprint calculation error
-			_, _ = fmt.Fprint(os.Stderr, "Fingerprint calculation error")
-			continue
+		if len(rec.Invalid) > 0 {
+			report.Flagged++
+			report.addError(rec.Line, joinFieldErrors(rec.Invalid))
 		}
+
+		fp := rec.Meta.Hash()
 		var index uint32
 		var ok bool
 		if index, ok = metaTable[fp]; !ok {
-			meta := &Meta{
-				Country:        rowMeta.Country,
-				Province:       rowMeta.Province,
-				City:           rowMeta.City,
-				Region:         rowMeta.Region,
-				OwnerDomain:    rowMeta.OwnerDomain,
-				IspDomain:      rowMeta.IspDomain,
-				ChinaAdminCode: rowMeta.ChinaAdminCode,
-				Latitude:       rowMeta.Latitude,
-				Longitude:      rowMeta.Longitude,
-				Timezone:       rowMeta.Timezone,
-				CountryCode:    rowMeta.CountryCode,
-				Asn:            rowMeta.Asn,
-				UsageType:      rowMeta.UsageType,
-				Line:           rowMeta.Line,
-				Comment:        rowMeta.Comment,
-				Type:           rowMeta.Type,
-			}
+			meta := rec.Meta
+			meta.Source = s.source
 			if s.opt.CB != nil {
 				meta.Extends = s.opt.CB(meta)
 			}
@@ -184,48 +223,34 @@ func (s *Store) UnmarshalFrom(reader io.Reader, t int) error {
 			metaTable[fp] = index
 		}
 
-		ipObj := rowMeta.StartIPObj()
-		if t == IPV6 {
-			if rowMeta.Mode() != IPV6 {
-				// Bad IP metadata
-				_, _ = fmt.Fprint(os.Stderr, "Bad IP metadata, start_ip=", rowMeta.StartIP)
-				continue
-			}
-			entity := &IPV6Entity{
-				startIndex: binary.BigEndian.Uint64(ipObj.To16()),
-				endIndex:   binary.BigEndian.Uint64(rowMeta.EndIpObj().To16()),
+		if start, end := rec.Start.To4(), rec.End.To4(); start != nil {
+			ipv4List = append(ipv4List, &IPV4Entity{
+				startIndex: binary.BigEndian.Uint32(start),
+				endIndex:   binary.BigEndian.Uint32(end),
 				metaIndex:  index,
-			}
-			ipv6List = append(ipv6List, entity)
+			})
 		} else {
-			if rowMeta.Mode() != IPV4 {
-				// Bad IP metadata
-				_, _ = fmt.Fprint(os.Stderr, "Bad IP metadata, start_ip=", rowMeta.StartIP)
-				continue
-			}
-			entity := &IPV4Entity{
-				startIndex: binary.BigEndian.Uint32(ipObj.To4()),
-				endIndex:   binary.BigEndian.Uint32(rowMeta.EndIpObj().To4()),
+			ipv6List = append(ipv6List, &IPV6Entity{
+				startIndex: binary.BigEndian.Uint64(rec.Start.To16()),
+				endIndex:   binary.BigEndian.Uint64(rec.End.To16()),
 				metaIndex:  index,
-			}
-			ipv4List = append(ipv4List, entity)
+			})
 		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("unmarshal entity list error, %s", err)
 	}
-	if err != io.EOF {
-		return fmt.Errorf("unmarshal entity list error, %s", err)
-	}
+	report.IPV4Count = len(ipv4List)
+	report.IPV6Count = len(ipv6List)
 
 	if len(ipv4List) > 0 {
-		s.v4Mu.Lock()
-		s.ipv4EntityList = ipv4List
-		s.v4MateList = tmpMetaList
-		s.v4Mu.Unlock()
+		snap.ipv4EntityList = ipv4List
+		snap.v4MateList = tmpMetaList
 	}
 	if len(ipv6List) > 0 {
-		s.v6Mu.Lock()
-		s.ipv6EntityList = ipv6List
-		s.v6MateList = tmpMetaList
-		s.v6Mu.Unlock()
+		snap.ipv6EntityList = ipv6List
+		snap.v6MateList = tmpMetaList
 	}
 
 	// Clear Memory
@@ -234,39 +259,168 @@ func (s *Store) UnmarshalFrom(reader io.Reader, t int) error {
 	metaTable = nil
 	tmpMetaList = nil
 
+	return report, nil
+}
+
+// validRecord Check the range and the meta of a decoded record.
+func validRecord(rec *Record) error {
+	if rec.Meta.Hash() == "" {
+		// Fingerprint calculation error
+		return errors.New("empty meta")
+	}
+	if start, end := rec.Start.To4(), rec.End.To4(); start != nil && end != nil {
+		if binary.BigEndian.Uint32(start) > binary.BigEndian.Uint32(end) {
+			return fmt.Errorf("bad IP range %s-%s", rec.Start, rec.End)
+		}
+		return nil
+	}
+	if rec.Start.To4() != nil || rec.End.To4() != nil || rec.Start.To16() == nil || rec.End.To16() == nil {
+		return fmt.Errorf("bad IP metadata, start_ip=%s", rec.Start)
+	}
+	if binary.BigEndian.Uint64(rec.Start.To16()) > binary.BigEndian.Uint64(rec.End.To16()) {
+		return fmt.Errorf("bad IP range %s-%s", rec.Start, rec.End)
+	}
 	return nil
 }
 
 // LoadData load data
 func (s *Store) LoadData(opt Option) error {
+	if s.immutable {
+		return ErrImmutable
+	}
 	if len(opt.Files) <= 0 {
 		return errors.New("no incoming data file")
 	}
+	s.editMu.Lock()
+	s.mu.Lock()
 	s.opt = opt
-	return s.update()
+	s.mu.Unlock()
+	s.editMu.Unlock()
+	if err := s.update(); err != nil {
+		// Start with the last-known-good data rather than nothing
+		if opt.CacheDir == "" || s.loadCache(err) != nil {
+			return err
+		}
+	}
+	return s.loadOverlays(opt)
 }
 
-// Update update data
+// Update update data, overlays are reloaded by ReloadOverlay.
 func (s *Store) Update() error {
+	if s.immutable {
+		return ErrImmutable
+	}
 	return s.update()
 }
 
+// update Load the data files into a new version, which is published only
+// once every file has been loaded.
 func (s *Store) update() error {
 	var err error
 
-	for _, fn := range s.opt.Files {
+	started := time.Now()
+	defer s.deliverEvents()
+	// Download before taking editMu, so that edits don't wait for the network
+	s.mu.RLock()
+	opt := s.opt
+	s.mu.RUnlock()
+	fetched, done, err := fetchAll(opt)
+	if err != nil {
+		return err
+	}
+	defer done()
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+	snap := s.snapshot()
+	var report LoadReport
+	manifest, err := s.loadManifest()
+	if err != nil {
+		return fmt.Errorf("load manifest %s error, %s", s.opt.Manifest, err)
+	}
+	states := make([]fileState, len(s.opt.Files))
+	var info Info
+	for i, fn := range s.opt.Files {
+		path := fn.Path
+		if local, ok := fetched[path]; ok {
+			path = local
+		} else if isRemote(path) {
+			// The files were replaced while downloading
+			var done func()
+			if path, done, err = fetch(s.opt, fn); err != nil {
+				return fmt.Errorf("fetch %s error, %s", fn.Path, err)
+			}
+			defer done()
+		}
 		// open file by filename
 		var fReader *os.File
-		if fReader, err = os.Open(fn.Path); err != nil {
+		if fReader, err = os.Open(path); err != nil {
 			return err
 		}
-		err = s.UnmarshalFrom(fReader, fn.Type)
-		if err != nil {
-			return err
+		// The file is hashed and authenticated before it is decoded, the
+		// state of the loaded file is the base of Watch
+		h := sha256.New()
+		fi, err := fReader.Stat()
+		if err == nil {
+			_, err = io.Copy(h, fReader)
+		}
+		sum := h.Sum(nil)
+		if err == nil && fn.Checksum != "" && !strings.EqualFold(hex.EncodeToString(sum), fn.Checksum) {
+			err = fmt.Errorf("checksum mismatch, got sha256 %x, want %s", sum, fn.Checksum)
+		}
+		if err == nil {
+			err = s.verifyFile(fn, sum, manifest)
+		}
+		if err == nil {
+			_, err = fReader.Seek(0, io.SeekStart)
+		}
+		var fr FileReport
+		var reader io.Reader
+		var encrypted bool
+		// Hashed again while decoding, to refuse a file changed meanwhile
+		h.Reset()
+		if err == nil {
+			reader, encrypted, err = s.decrypt(fn, io.TeeReader(fReader, h))
+		}
+		if err == nil {
+			fr, err = s.unmarshalFrom(reader, fn.Type, snap)
+			fr.Encrypted = encrypted
+		}
+		if err == nil {
+			_, err = io.Copy(h, fReader)
 		}
-
 		_ = fReader.Close()
+		if err == nil && !bytes.Equal(h.Sum(nil), sum) {
+			err = errors.New("file changed while loading")
+		}
+		if err != nil {
+			return fmt.Errorf("load %s error, %s", fn.Path, err)
+		}
+		states[i] = fileState{exists: true, size: fi.Size(), modTime: fi.ModTime()}
+		copy(states[i].sum[:], sum)
+		// The sidecar file is not signed, with trusted keys only the
+		// metadata lines of the signed file are used
+		if len(s.opt.TrustedKeys) == 0 {
+			sidecar, ok, err := readSidecar(fn.Path)
+			if err != nil {
+				return fmt.Errorf("load %s error, %s", fn.Path, err)
+			}
+			if ok {
+				fr.Info = sidecar
+			}
+		}
+		fr.Path = fn.Path
+		report.Files = append(report.Files, fr)
+		info = info.merge(fr.Info)
 	}
+	snap.info = info
 
+	s.commit(snap, report, started)
+	s.mu.Lock()
+	s.files = states
+	s.mu.Unlock()
+	if s.opt.CacheDir != "" {
+		// Best effort, the data is loaded anyway
+		_ = s.saveCache(snap)
+	}
 	return nil
 }
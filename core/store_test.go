@@ -2,10 +2,24 @@
 package core
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"io"
 	"net"
+	"os"
+	"strings"
 	"testing"
 )
 
+// writeFile Write data to the file at path, failing the test on error.
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestLoad(t *testing.T) {
 	st := NewStore()
 	t.Log(st.LoadData(Option{
@@ -27,6 +41,29 @@ func TestSearch(t *testing.T) {
 	t.Log(st.Search(net.ParseIP("2001:506:100:40::2:1")))
 }
 
+func TestSearchLastRange(t *testing.T) {
+	st := NewStore()
+	v4 := "start_ip\tend_ip\tcountry\n1.0.0.0\t1.0.0.255\tCN\n1.0.1.0\t1.0.1.255\tJP\n"
+	if err := st.UnmarshalFrom(strings.NewReader(v4), IPV4); err != nil {
+		t.Fatal(err)
+	}
+	v6 := "start_ip\tend_ip\tcountry\n2001:db8::\t2001:db8::ffff\tCN\n2001:db9::\t2001:db9::ffff\tJP\n"
+	if err := st.UnmarshalFrom(strings.NewReader(v6), IPV6); err != nil {
+		t.Fatal(err)
+	}
+	// addresses above the start of the last range must still be found
+	for _, addr := range []string{"1.0.1.0", "1.0.1.128", "1.0.1.255", "2001:db9::", "2001:db9::1"} {
+		if m := st.Search(net.ParseIP(addr)); m == nil || m.Country != "JP" {
+			t.Errorf("%s: unexpected meta %v", addr, m)
+		}
+	}
+	for _, addr := range []string{"1.0.2.0", "2001:dba::1"} {
+		if m := st.Search(net.ParseIP(addr)); m != nil {
+			t.Errorf("%s: unexpected meta %v", addr, m)
+		}
+	}
+}
+
 func BenchmarkStore_Search(b *testing.B) {
 	st := NewStore()
 	if err := st.LoadData(Option{
@@ -41,3 +78,141 @@ func BenchmarkStore_Search(b *testing.B) {
 		st.Search(addr)
 	}
 }
+
+func TestRegisterDecoder(t *testing.T) {
+	RegisterDecoder("test-csv", DecoderFunc(func(r io.Reader, fn RecordFunc) error {
+		rows, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err = fn(&Record{
+				Start: net.ParseIP(row[0]),
+				End:   net.ParseIP(row[1]),
+				Meta:  &Meta{Country: row[2]},
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	st := NewStore()
+	data := "10.0.0.0,10.0.0.255,A\n10.0.1.0,10.0.1.255,B\n2001:db8::,2001:db8::ffff,C\n"
+	if err := st.UnmarshalFrom(strings.NewReader(data), "test-csv"); err != nil {
+		t.Fatal(err)
+	}
+	if st.IPV4EntityCount() != 2 || st.IPV6EntityCount() != 1 {
+		t.Fatalf("unexpected entity count v4=%d v6=%d", st.IPV4EntityCount(), st.IPV6EntityCount())
+	}
+	if r := st.Report(); len(r.Files) != 1 || r.Files[0].Type != "test-csv" || r.Files[0].Rows != 3 {
+		t.Errorf("unexpected report %+v", r)
+	}
+	for addr, country := range map[string]string{"10.0.0.8": "A", "10.0.1.8": "B", "2001:db8::1": "C"} {
+		if m := st.Search(net.ParseIP(addr)); m == nil || m.Country != country {
+			t.Errorf("Search(%s) = %v, want country %s", addr, m, country)
+		}
+	}
+	if err := st.UnmarshalFrom(strings.NewReader(data), "no-such-format"); err == nil {
+		t.Error("expected error for unregistered format")
+	}
+}
+
+func TestAutoDetect(t *testing.T) {
+	st := NewStore()
+	if err := st.LoadData(Option{
+		Files: []FileInfo{{Path: "testdata/v6.txt", Type: Auto}, {Path: "testdata/v4.txt", Type: Auto}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	report := st.Report()
+	if len(report.Files) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if f := report.Files[0]; f.Detected != IPV6 || f.Columns != 15 || f.IPV6Count == 0 {
+		t.Errorf("unexpected v6 report %+v", f)
+	}
+	if f := report.Files[1]; f.Detected != IPV4 || f.Columns != 16 || f.IPV4Count == 0 {
+		t.Errorf("unexpected v4 report %+v", f)
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil {
+		t.Error("expected v4 result")
+	}
+
+	// gzip compressed data is decompressed transparently
+	raw, err := os.ReadFile("testdata/v4.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(raw)
+	_ = zw.Close()
+	fr, err := NewStore().unmarshalFrom(&buf, Auto, &snapshot{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fr.Compression != "gzip" || fr.Detected != IPV4 || fr.IPV4Count != st.IPV4EntityCount() {
+		t.Errorf("unexpected gzip report %+v", fr)
+	}
+
+	// a wrong explicit type is refused instead of silently loading nothing
+	if err = NewStore().UnmarshalFrom(bytes.NewReader(raw), IPV6); err == nil {
+		t.Error("expected data type mismatch error")
+	}
+	if err = NewStore().UnmarshalFrom(strings.NewReader("hello\tworld\n"), Auto); err == nil {
+		t.Error("expected detection error")
+	}
+}
+
+// binaryTestDecoder Binary format recognised by its magic bytes.
+type binaryTestDecoder struct{}
+
+func (binaryTestDecoder) Magic() []byte { return []byte("TBIN") }
+
+func (binaryTestDecoder) Decode(r io.Reader, fn RecordFunc) error {
+	return fn(&Record{Start: net.ParseIP("10.8.0.0"), End: net.ParseIP("10.8.0.255"), Meta: &Meta{Country: "B"}})
+}
+
+// shortTestDecoder Text format with a three column layout, detected on the
+// same rows as the ipv4 format.
+type shortTestDecoder struct{ dec *textDecoder }
+
+func (d shortTestDecoder) Decode(r io.Reader, fn RecordFunc) error { return d.dec.Decode(r, fn) }
+func (d shortTestDecoder) Detect(head []byte) bool                 { return d.dec.Detect(head) }
+func (d shortTestDecoder) MatchColumns(n int) bool                 { return d.dec.MatchColumns(n) }
+
+func TestDetectFormat(t *testing.T) {
+	RegisterDecoder("test-bin", binaryTestDecoder{})
+	RegisterDecoder("test-short", shortTestDecoder{&textDecoder{
+		family: IPV4,
+		schema: &Schema{Columns: []string{ColStartIP, ColEndIP, ColCountry}},
+	}})
+
+	if name, err := DetectFormat([]byte("TBIN\x00\x01")); err != nil || name != "test-bin" {
+		t.Errorf("DetectFormat(binary) = %q, %v", name, err)
+	}
+	// the ipv4 format also detects the row, the column count breaks the tie
+	if name, err := DetectFormat([]byte("10.9.0.0\t10.9.0.255\tS\n")); err != nil || name != "test-short" {
+		t.Errorf("DetectFormat(short) = %q, %v", name, err)
+	}
+	raw, err := os.ReadFile("testdata/v4.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := DetectFormat(raw[:sniffLen]); err != nil || name != IPV4 {
+		t.Errorf("DetectFormat(v4) = %q, %v", name, err)
+	}
+
+	st := NewStore()
+	if err = st.UnmarshalFrom(strings.NewReader("TBIN"), Auto); err != nil {
+		t.Fatal(err)
+	}
+	if m := st.Search(net.ParseIP("10.8.0.1")); m == nil || m.Country != "B" {
+		t.Errorf("unexpected meta %v", m)
+	}
+	err = NewStore().UnmarshalFrom(bytes.NewReader([]byte{0x28, 0xb5, 0x2f, 0xfd, 0}), Auto)
+	if err == nil || !strings.Contains(err.Error(), "zstd") {
+		t.Errorf("expected unsupported zstd error, got %v", err)
+	}
+}
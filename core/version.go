@@ -0,0 +1,107 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// Version Describe a version of the data of a store. Every load and every
+// applied patch makes a new version, Set and Delete change the published
+// version.
+type Version struct {
+	ID       uint64     // Increasing identifier of the version, starting at 1
+	LoadedAt time.Time  // Time the version was made
+	Report   LoadReport // Report of the load that made the version
+}
+
+// version Define a retained version and its ranges.
+type version struct {
+	Version
+	snap *snapshot
+}
+
+// Versions Return the retained versions, oldest first. Option.History sets
+// how many versions are kept besides the published one.
+func (s *Store) Versions() []Version {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions := make([]Version, len(s.versions))
+	for i, v := range s.versions {
+		versions[i] = v.Version
+	}
+	return versions
+}
+
+// Version Return the identifier of the published version, 0 if nothing
+// was loaded.
+func (s *Store) Version() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.versions) == 0 {
+		return 0
+	}
+	return s.versions[s.current].ID
+}
+
+// Rollback Publish a retained version again. Newer versions are kept, so
+// that a rollback can be undone by another one.
+func (s *Store) Rollback(id uint64) error {
+	if s.immutable {
+		return ErrImmutable
+	}
+	started := time.Now()
+	defer s.deliverEvents()
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+
+	s.mu.RLock()
+	index := -1
+	for i, v := range s.versions {
+		if v.ID == id {
+			index = i
+			break
+		}
+	}
+	s.mu.RUnlock()
+	if index < 0 {
+		return fmt.Errorf("unknown version %d", id)
+	}
+
+	old := s.Version()
+	s.mu.RLock()
+	v := s.versions[index]
+	s.mu.RUnlock()
+	s.queueEvent(s.snapshot(), v.snap, ReloadEvent{OldVersion: old, NewVersion: id, Report: v.Report, Duration: time.Since(started)})
+
+	s.mu.Lock()
+	s.current = index
+	s.report = v.Report
+	s.mu.Unlock()
+	s.publish(v.snap)
+	return nil
+}
+
+// commit Publish the snapshot as a new version, dropping the oldest
+// versions beyond the history size, and queue its reload event. The caller
+// holds editMu and started loading the snapshot at started.
+func (s *Store) commit(snap *snapshot, report LoadReport, started time.Time) {
+	old := s.Version()
+	v := &version{Version: Version{ID: 1, LoadedAt: time.Now(), Report: report}}
+	s.mu.RLock()
+	if n := len(s.versions); n > 0 {
+		v.ID = s.versions[n-1].ID + 1
+	}
+	s.mu.RUnlock()
+	s.queueEvent(s.snapshot(), snap, ReloadEvent{OldVersion: old, NewVersion: v.ID, Report: report, Duration: time.Since(started)})
+
+	s.mu.Lock()
+	s.versions = append(s.versions, v)
+	if keep := s.opt.History + 1; len(s.versions) > keep {
+		s.versions = append([]*version(nil), s.versions[len(s.versions)-keep:]...)
+	}
+	s.current = len(s.versions) - 1
+	s.report = report
+	s.mu.Unlock()
+	s.publish(snap)
+}
@@ -0,0 +1,47 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/v4.txt"
+	province := func(st *Store) string {
+		if m := st.Search(net.ParseIP("1.55.29.242")); m != nil {
+			return m.Province
+		}
+		return ""
+	}
+
+	writeFile(t, path, "1.55.0.0\t1.55.255.255\t中国\tv1\n")
+	st := NewStore()
+	if err := st.LoadData(Option{Files: []FileInfo{{Path: path, Type: IPV4}}, History: 1, ParseMode: Lenient}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"v2", "v3"} {
+		writeFile(t, path, "1.55.0.0\t1.55.255.255\t中国\t"+name+"\n")
+		if err := st.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions := st.Versions()
+	if len(versions) != 2 || versions[0].ID != 2 || versions[1].ID != 3 || st.Version() != 3 || province(st) != "v3" {
+		t.Fatalf("unexpected versions %+v, published %d", versions, st.Version())
+	}
+
+	if err := st.Rollback(2); err != nil {
+		t.Fatal(err)
+	}
+	if st.Version() != 2 || province(st) != "v2" {
+		t.Errorf("got version %d %s after rollback, want 2 v2", st.Version(), province(st))
+	}
+	if err := st.Rollback(1); err == nil {
+		t.Error("expected error for dropped version")
+	}
+	if err := st.Rollback(3); err != nil || province(st) != "v3" {
+		t.Errorf("got %v %s after roll forward, want v3", err, province(st))
+	}
+}
@@ -0,0 +1,128 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"time"
+)
+
+// WatchOption Define how Watch polls the data files.
+type WatchOption struct {
+	Interval time.Duration   // Time between polls, 10 seconds by default
+	Checksum bool            // Also compare the content of the files, which costs reading them at every poll
+	OnReload func(err error) // Called after every reload with its result
+}
+
+// fileState Define the observed state of a data file.
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+	sum     [sha256.Size]byte
+}
+
+// Watch Poll the data files of the store and reload them when they change.
+// A change is reloaded once the files stayed the same for a whole interval,
+// so that files being written are not loaded. Overlays and remote files
+// are not watched.
+// Watch blocks until the context is done and returns its error.
+func (s *Store) Watch(ctx context.Context, opt WatchOption) error {
+	if s.immutable {
+		return ErrImmutable
+	}
+	if opt.Interval <= 0 {
+		opt.Interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(opt.Interval)
+	defer ticker.Stop()
+
+	s.mu.RLock()
+	loaded := s.files
+	s.mu.RUnlock()
+	var pending []fileState
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		states := s.fileStates(loaded, opt.Checksum)
+		switch {
+		case sameStates(states, loaded, opt.Checksum):
+			pending = nil
+		case !sameStates(states, pending, true):
+			// Changed since the last poll, wait for the files to settle
+			pending = states
+		default:
+			err := s.Update()
+			if err != nil {
+				// Retry only when the files change again
+				loaded = states
+			} else {
+				s.mu.RLock()
+				loaded = s.files
+				s.mu.RUnlock()
+			}
+			pending = nil
+			if opt.OnReload != nil {
+				opt.OnReload(err)
+			}
+		}
+	}
+}
+
+// fileStates Return the state of every data file of the store. Remote
+// files keep their loaded state, they are checked by Update.
+func (s *Store) fileStates(loaded []fileState, checksum bool) []fileState {
+	s.mu.RLock()
+	files := append([]FileInfo{}, s.opt.Files...)
+	s.mu.RUnlock()
+	states := make([]fileState, len(files))
+	for i, fn := range files {
+		if isRemote(fn.Path) {
+			if i < len(loaded) {
+				states[i] = loaded[i]
+			}
+			continue
+		}
+		fi, err := os.Stat(fn.Path)
+		if err != nil {
+			continue
+		}
+		states[i] = fileState{exists: true, size: fi.Size(), modTime: fi.ModTime()}
+		if checksum {
+			f, err := os.Open(fn.Path)
+			if err != nil {
+				states[i].exists = false
+				continue
+			}
+			h := sha256.New()
+			_, err = io.Copy(h, f)
+			_ = f.Close()
+			if err != nil {
+				states[i].exists = false
+				continue
+			}
+			copy(states[i].sum[:], h.Sum(nil))
+		}
+	}
+	return states
+}
+
+// sameStates Report whether both lists hold the same file states, the
+// checksums are compared only if checksum is set.
+func sameStates(a, b []fileState, checksum bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].exists != b[i].exists || a[i].size != b[i].size ||
+			!a[i].modTime.Equal(b[i].modTime) || (checksum && a[i].sum != b[i].sum) {
+			return false
+		}
+	}
+	return true
+}
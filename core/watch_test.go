@@ -0,0 +1,81 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	path := t.TempDir() + "/v4.txt"
+	writeFile(t, path, "1.55.0.0\t1.55.255.255\t中国\t旧\n")
+	st := NewStore()
+	if err := st.LoadData(Option{Files: []FileInfo{{Path: path, Type: IPV4}}, ParseMode: Lenient}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reloaded := make(chan error, 10)
+	done := make(chan error)
+	go func() {
+		done <- st.Watch(ctx, WatchOption{Interval: 10 * time.Millisecond, Checksum: true, OnReload: func(err error) {
+			reloaded <- err
+		}})
+	}()
+
+	writeFile(t, path, "1.55.0.0\t1.55.255.255\t中国\t新\n")
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("file change not reloaded")
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.Province != "新" {
+		t.Errorf("unexpected result after reload %v", m)
+	}
+
+	writeFile(t, path, "start_ip\tend_ip\tno_such_column\n")
+	select {
+	case err := <-reloaded:
+		if err == nil {
+			t.Error("expected reload error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("file change not reloaded")
+	}
+	if m := st.Search(net.ParseIP("1.55.29.242")); m == nil || m.Province != "新" {
+		t.Errorf("failed reload must keep the data, got %v", m)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestWatchWhileLoading(t *testing.T) {
+	// run with -race: the watcher reads the file list replaced by loads
+	path := t.TempDir() + "/v4.txt"
+	writeFile(t, path, "1.55.0.0\t1.55.255.255\t中国\t旧\n")
+	opt := Option{Files: []FileInfo{{Path: path, Type: IPV4}}, ParseMode: Lenient}
+	st := NewStore()
+	if err := st.LoadData(opt); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- st.Watch(ctx, WatchOption{Interval: time.Millisecond}) }()
+	for i := 0; i < 20; i++ {
+		if err := st.LoadData(opt); err != nil {
+			t.Fatal(err)
+		}
+		st.WithDataFiles(opt.Files)
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,159 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/universal-fraternity/ipip/utils"
+)
+
+// RangeFunc Callback invoked for every range of a store, returning false
+// stops the walk.
+type RangeFunc func(start, end net.IP, meta *Meta) bool
+
+// Walk Call fn for every range of the family in address order.
+// IPv6 ranges are indexed by their upper 64 bits, so they always span
+// whole /64 networks.
+func (s *Store) Walk(family string, fn RangeFunc) {
+	switch family {
+	case IPV4:
+		s.v4Mu.RLock()
+		entities, metas := s.ipv4EntityList, s.v4MateList
+		s.v4Mu.RUnlock()
+		for _, e := range entities {
+			if !fn(v4IP(e.startIndex), v4IP(e.endIndex), metas[e.metaIndex]) {
+				return
+			}
+		}
+	case IPV6:
+		s.v6Mu.RLock()
+		entities, metas := s.ipv6EntityList, s.v6MateList
+		s.v6Mu.RUnlock()
+		for _, e := range entities {
+			if !fn(v6IP(e.startIndex, 0), v6IP(e.endIndex, ^uint64(0)), metas[e.metaIndex]) {
+				return
+			}
+		}
+	}
+}
+
+// WriteText Serialize the ranges of the family in the ipip text format, so
+// that UnmarshalFrom reads them back identically. IPv4 ranges are written
+// as start/end pairs and IPv6 ranges as CIDRs, a range that is not a single
+// CIDR is written as several rows. A header line is written only when the
+// metas carry a type, a comment or custom attributes, and the metadata
+// lines only when the store has metadata. Backslashes, tabs and line
+// breaks of the values are escaped like Meta.MarshalText.
+func (s *Store) WriteText(w io.Writer, family string) error {
+	var columns []string
+	switch family {
+	case IPV4:
+		columns = V4Columns
+	case IPV6:
+		columns = V6Columns
+	default:
+		return errors.New("unknown data type")
+	}
+	// The metadata, the columns and the rows come from the same version,
+	// even when the store is reloaded meanwhile.
+	view := s.snapshot().store()
+	columns, header := view.textColumns(family, columns)
+
+	bw := bufio.NewWriter(w)
+	if info := view.Info(); info.declared() {
+		info.IPV4Count, info.IPV6Count = 0, 0
+		if family == IPV4 {
+			info.IPV4Count = view.IPV4EntityCount()
+		} else {
+			info.IPV6Count = view.cidrCount(family)
+		}
+		_ = writeInfo(bw, info)
+	}
+	if header {
+		_, _ = bw.WriteString(strings.Join(columns, "\t") + "\n")
+	}
+	fields := make([]string, len(columns))
+	view.Walk(family, func(start, end net.IP, meta *Meta) bool {
+		for i, name := range columns[1:] {
+			fields[i+1] = textEscaper.Replace(textField(meta.Column(name)))
+		}
+		if family == IPV4 {
+			fields[0] = start.String()
+			fields[1] = end.String()
+			_, _ = bw.WriteString(strings.Join(fields, "\t") + "\n")
+			return true
+		}
+		for _, cidr := range utils.RangeToCIDRs(start, end) {
+			fields[0] = cidr.String()
+			_, _ = bw.WriteString(strings.Join(fields, "\t") + "\n")
+		}
+		return true
+	})
+	return bw.Flush()
+}
+
+// cidrCount Return the number of CIDRs covering the ranges of the family.
+func (s *Store) cidrCount(family string) int {
+	n := 0
+	s.Walk(family, func(start, end net.IP, _ *Meta) bool {
+		n += len(utils.RangeToCIDRs(start, end))
+		return true
+	})
+	return n
+}
+
+// textColumns Return the columns needed to write the metas of the family:
+// the default layout, the type and comment columns when a meta uses them,
+// then the attribute names. header reports whether the layout differs from
+// the default one and must be announced by a header line.
+func (s *Store) textColumns(family string, columns []string) ([]string, bool) {
+	var typed bool
+	s.Walk(family, func(_, _ net.IP, meta *Meta) bool {
+		typed = meta.Type != nil || meta.Comment != nil
+		return !typed
+	})
+	columns = append([]string{}, columns...)
+	if typed {
+		columns = append(columns, ColType, ColComment)
+	}
+	names := s.attrNames(family)
+	return append(columns, names...), typed || len(names) > 0
+}
+
+// attrNames Return the sorted names of the attributes used by the family.
+func (s *Store) attrNames(family string) []string {
+	attrs := make(Attrs)
+	s.Walk(family, func(_, _ net.IP, meta *Meta) bool {
+		for k := range meta.Attrs {
+			attrs[k] = ""
+		}
+		return true
+	})
+	return attrs.keys()
+}
+
+// textField Return the text form of a field, empty fields are written as *.
+func textField(v string) string {
+	if v == "" {
+		return "*"
+	}
+	return v
+}
+
+func v4IP(index uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, index)
+	return ip
+}
+
+func v6IP(high, low uint64) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	binary.BigEndian.PutUint64(ip, high)
+	binary.BigEndian.PutUint64(ip[8:], low)
+	return ip
+}
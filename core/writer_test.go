@@ -0,0 +1,147 @@
+// Package core provides data core logics for handling IPV4/6 address.
+package core
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type walkedRange struct {
+	start, end string
+	meta       *Meta
+}
+
+func walkAll(st *Store, family string) []walkedRange {
+	var ranges []walkedRange
+	st.Walk(family, func(start, end net.IP, meta *Meta) bool {
+		ranges = append(ranges, walkedRange{start: start.String(), end: end.String(), meta: meta})
+		return true
+	})
+	return ranges
+}
+
+func TestWriteTextRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		family, path string
+	}{{IPV4, "testdata/v4.txt"}, {IPV6, "testdata/v6.txt"}} {
+		t.Run(tc.family, func(t *testing.T) {
+			st := NewStore()
+			if err := st.LoadData(Option{Files: []FileInfo{{Path: tc.path, Type: tc.family}}}); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := st.WriteText(&buf, tc.family); err != nil {
+				t.Fatal(err)
+			}
+			text := buf.String()
+
+			st2 := NewStore()
+			if err := st2.UnmarshalFrom(strings.NewReader(text), tc.family); err != nil {
+				t.Fatal(err)
+			}
+			want, got := walkAll(st, tc.family), walkAll(st2, tc.family)
+			if len(want) == 0 || !reflect.DeepEqual(want, got) {
+				t.Fatalf("round trip mismatch, %d ranges before and %d after", len(want), len(got))
+			}
+
+			buf.Reset()
+			if err := st2.WriteText(&buf, tc.family); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != text {
+				t.Error("second serialization differs from the first")
+			}
+		})
+	}
+}
+
+func TestWriteTextEmptyFields(t *testing.T) {
+	// empty fields are written as *, which must read back as empty
+	st := NewStore()
+	if err := st.UnmarshalFrom(strings.NewReader("start_ip\tend_ip\tcountry\tcity\tasn\n10.0.0.0\t10.0.0.255\t*\t大连\t*\n"), IPV4); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := st.WriteText(&buf, IPV4); err != nil {
+		t.Fatal(err)
+	}
+	snap := &snapshot{}
+	fr, err := NewStore().unmarshalFrom(&buf, IPV4, snap)
+	if err != nil || fr.Rejected != 0 || fr.IPV4Count != 1 {
+		t.Fatalf("unexpected report %+v, %v", fr, err)
+	}
+	if m := snap.store().Search(net.ParseIP("10.0.0.1")); m == nil || m.Country != "" || m.Asn != nil {
+		t.Errorf("unexpected meta %v", m)
+	}
+}
+
+func TestWriteTextEscaping(t *testing.T) {
+	b := NewBuilder()
+	want := &Meta{Country: "中国", City: "a\tb", Line: "c\nd\\e\rf"}
+	if err := b.AddPrefix(netip.MustParsePrefix("10.0.0.0/24"), want); err != nil {
+		t.Fatal(err)
+	}
+	st, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = st.WriteText(&buf, IPV4); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Fatalf("unescaped line breaks in\n%s", buf.String())
+	}
+	snap := &snapshot{}
+	fr, err := NewStore().unmarshalFrom(&buf, IPV4, snap)
+	if err != nil || fr.Rejected != 0 || fr.Flagged != 0 {
+		t.Fatalf("unexpected report %+v, %v", fr, err)
+	}
+	if m := snap.store().Search(net.ParseIP("10.0.0.1")); m.Hash() != want.Hash() {
+		t.Errorf("got %v, want %v", m, want)
+	}
+}
+
+func TestWriteTextAttrs(t *testing.T) {
+	data := "start_ip\tend_ip\tcountry\tdc_tag\ttype\n" +
+		"10.0.0.0\t10.0.0.255\t中国\tsh-01\tIDC\n" +
+		"10.0.1.0\t10.0.1.255\t日本\t*\t*\n"
+	st := NewStore()
+	st.opt.Schema = &Schema{Attrs: true}
+	if err := st.UnmarshalFrom(strings.NewReader(data), IPV4); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := st.WriteText(&buf, IPV4); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), strings.Join(V4Columns, "\t")+"\ttype\tcomment\tdc_tag\n") {
+		t.Fatalf("unexpected header in %q", buf.String())
+	}
+	st2 := NewStore()
+	st2.opt.Schema = st.opt.Schema
+	if err := st2.UnmarshalFrom(&buf, IPV4); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(walkAll(st, IPV4), walkAll(st2, IPV4)) {
+		t.Error("round trip mismatch")
+	}
+}
+
+func TestWriteTextSplitsCIDRs(t *testing.T) {
+	st := NewStore()
+	if err := st.UnmarshalFrom(strings.NewReader("start_ip\tend_ip\tcountry\n2001:db8::\t2001:db8:0:2:ffff:ffff:ffff:ffff\t中国\n"), IPV6); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := st.WriteText(&buf, IPV6); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "2001:db8::/63\t中国\t") || !strings.Contains(buf.String(), "\n2001:db8:0:2::/64\t中国\t") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
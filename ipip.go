@@ -2,6 +2,8 @@
 package ipip
 
 import (
+	"context"
+	"io"
 	"net"
 	"sync"
 
@@ -25,6 +27,50 @@ type Option = core.Option
 // FileInfo output core.FileInfo
 type FileInfo = core.FileInfo
 
+// Schema output core.Schema
+type Schema = core.Schema
+
+// Overlay output core.Overlay
+type Overlay = core.Overlay
+
+// ParseMode output core.ParseMode
+type ParseMode = core.ParseMode
+
+// LoadReport output core.LoadReport
+type LoadReport = core.LoadReport
+
+// ExportOption output core.ExportOption
+type ExportOption = core.ExportOption
+
+// Record output core.Record
+type Record = core.Record
+
+// Decoder output core.Decoder
+type Decoder = core.Decoder
+
+// Version output core.Version
+type Version = core.Version
+
+// History output core.History
+type History = core.History
+
+// WatchOption output core.WatchOption
+type WatchOption = core.WatchOption
+
+// Fetcher output core.Fetcher
+type Fetcher = core.Fetcher
+
+// ReloadEvent output core.ReloadEvent
+type ReloadEvent = core.ReloadEvent
+
+// Info output core.Info
+type Info = core.Info
+
+// RegisterDecoder Register a decoder for the format name used as FileInfo.Type.
+func RegisterDecoder(name string, d Decoder) {
+	core.RegisterDecoder(name, d)
+}
+
 // Init init core.Store and load data
 func Init(opt Option) error {
 	once.Do(func() {
@@ -49,3 +95,59 @@ func update(fs ...FileInfo) error {
 func Search(addr string) *Meta {
 	return defaultStore.Search(net.ParseIP(addr))
 }
+
+// ReloadOverlay Reload the data files of the named overlay.
+func ReloadOverlay(name string) error {
+	return defaultStore.ReloadOverlay(name)
+}
+
+// Report Return the report of the last load.
+func Report() LoadReport {
+	return defaultStore.Report()
+}
+
+// Export Write every range of the loaded data in a bulk format.
+func Export(w io.Writer, opt ExportOption) error {
+	return defaultStore.Export(w, opt)
+}
+
+// ApplyPatch Apply a patch made by core.MakePatch to the loaded data.
+func ApplyPatch(r io.Reader) error {
+	return defaultStore.ApplyPatch(r)
+}
+
+// ApplyPatchFile Apply a patch file made by core.MakePatch to the loaded
+// data, checking its signature like the data files.
+func ApplyPatchFile(fn FileInfo) error {
+	return defaultStore.ApplyPatchFile(fn)
+}
+
+// Versions Return the retained versions of the loaded data, oldest first.
+func Versions() []Version {
+	return defaultStore.Versions()
+}
+
+// Rollback Publish a retained version of the loaded data again.
+func Rollback(id uint64) error {
+	return defaultStore.Rollback(id)
+}
+
+// Watch Reload the data files when they change, until the context is done.
+func Watch(ctx context.Context, opt WatchOption) error {
+	return defaultStore.Watch(ctx, opt)
+}
+
+// Stale Report whether the loaded data comes from the last-known-good cache.
+func Stale() bool {
+	return defaultStore.Stale()
+}
+
+// OnReload Subscribe fn to the reload events of the loaded data.
+func OnReload(fn func(ReloadEvent)) (cancel func()) {
+	return defaultStore.OnReload(fn)
+}
+
+// DataInfo Return the metadata of the loaded data, see core.Store.Info.
+func DataInfo() Info {
+	return defaultStore.Info()
+}
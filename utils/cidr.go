@@ -1,7 +1,10 @@
 // Package utils provides a unified processing method
 package utils
 
-import "net"
+import (
+	"math/big"
+	"net"
+)
 
 // LastIP Calculate the last IP address of a given CIDR
 func LastIP(cidr *net.IPNet) net.IP {
@@ -13,3 +16,42 @@ func LastIP(cidr *net.IPNet) net.IP {
 	}
 	return last
 }
+
+// RangeToCIDRs Split the address range from start to end into the fewest
+// CIDRs covering it exactly.
+func RangeToCIDRs(start, end net.IP) []*net.IPNet {
+	if v4 := start.To4(); v4 != nil && end.To4() != nil {
+		start, end = v4, end.To4()
+	} else {
+		start, end = start.To16(), end.To16()
+	}
+	if start == nil || end == nil {
+		return nil
+	}
+	bits := len(start) * 8
+	from := new(big.Int).SetBytes(start)
+	to := new(big.Int).SetBytes(end)
+	one := big.NewInt(1)
+
+	var cidrs []*net.IPNet
+	for from.Cmp(to) <= 0 {
+		// The largest block starting at from that is aligned and within to.
+		size := int(from.TrailingZeroBits())
+		if from.Sign() == 0 {
+			size = bits
+		}
+		for size > 0 {
+			last := new(big.Int).Lsh(one, uint(size))
+			last.Add(last, from).Sub(last, one)
+			if last.Cmp(to) <= 0 {
+				break
+			}
+			size--
+		}
+		ip := make(net.IP, len(start))
+		from.FillBytes(ip)
+		cidrs = append(cidrs, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits-size, bits)})
+		from.Add(from, new(big.Int).Lsh(one, uint(size)))
+	}
+	return cidrs
+}